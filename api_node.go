@@ -1,47 +1,192 @@
 package art
 
+import (
+	"bytes"
+)
+
+// WalkFn is used when walking the tree. Takes a key and value, returning if
+// iteration should be terminated.
+type WalkFn[V any] func(k []byte, v V) bool
+
 // APINode is a public veneer that matches the public interface of iradix.Node
 // for drop-in compatibility while abstracting the complications of the internal
 // ART node types.
-type APINode struct {
-	h *nodeHeader
+type APINode[V any] struct {
+	h *nodeHeader[V]
+	// tree is the tree this node is the root of if any. It's needed to watch
+	// keys that don't have an inner node to watch.
+	tree *Tree[V]
 }
 
 // func (n *APINode) Dump(prefix string) string {
 // 	return "TODO"
 // }
 
-// func (n *APINode) Get(k []byte) (interface{}, bool) {
-// }
-
-// func (n *APINode) GetWatch(k []byte) (<-chan struct{}, interface{}, bool) {
-
-// }
-
-// func (n *APINode) Iterator() *Iterator {
+// Get is used to lookup a specific key, returning the value and if it was
+// found.
+func (n *APINode[V]) Get(k []byte) (V, bool) {
+	var zero V
+	if leaf := n.h.findLeaf(k); leaf != nil {
+		return leaf.value, true
+	}
+	return zero, false
+}
 
-// }
+// GetWatch is used to lookup a specific key, returning the watch channel,
+// value and if it was found. The channel is closed when a later commit changes
+// the key. If the key wasn't found the channel is instead closed when the node
+// where it would be inserted is changed which includes the key being added.
+func (n *APINode[V]) GetWatch(k []byte) (<-chan struct{}, V, bool) {
+	var zero V
+	inner, leaf := n.h.search(k, 0)
+	if n.tree == nil || n.tree.watches == nil {
+		// Nothing to register with so we can't watch.
+		if leaf != nil {
+			return nil, leaf.value, true
+		}
+		return nil, zero, false
+	}
+	if leaf != nil {
+		return n.tree.watches.watch(n.tree.version, &leaf.replaced, leaf.id), leaf.value, true
+	}
+	if inner != nil {
+		return n.tree.watches.watch(n.tree.version, &inner.replaced, inner.id), zero, false
+	}
+	return n.tree.watches.watchVersion(n.tree.version), zero, false
+}
 
-// func (n *APINode) LongestPrefix(k []byte) ([]byte, interface{}, bool) {
+// WatchPrefix returns a channel that is closed when any key starting with
+// prefix is inserted, updated or deleted by a later commit. It may also fire
+// for changes to other keys nearby in the tree.
+func (n *APINode[V]) WatchPrefix(prefix []byte) <-chan struct{} {
+	if n.tree == nil || n.tree.watches == nil {
+		return nil
+	}
+	match, parent := n.h.seekPrefixParent(prefix)
+	switch {
+	case match != nil && match.typ != typLeaf:
+		// Any change below the covering node replaces it.
+		return n.tree.watches.watch(n.tree.version, &match.replaced, match.id)
+	case parent != nil:
+		// A leaf isn't replaced when a new key is added beside it and if there is
+		// no match the key would be added here anyway so watch the parent.
+		return n.tree.watches.watch(n.tree.version, &parent.replaced, parent.id)
+	}
+	return n.tree.watches.watchVersion(n.tree.version)
+}
 
-// }
+// Iterator is used to return an iterator at the given node to walk the tree.
+func (n *APINode[V]) Iterator() *Iterator[V] {
+	it := &Iterator[V]{node: n.h}
+	it.reset()
+	return it
+}
 
-// func (n *APINode) Maximum() ([]byte, interface{}, bool) {
+// LongestPrefix is like Get, but instead of an exact match, it will return the
+// longest key that is a prefix of k along with its value.
+func (n *APINode[V]) LongestPrefix(k []byte) ([]byte, V, bool) {
+	var key []byte
+	var val V
+	var found bool
+	// WalkPath visits shorter keys first so the last one wins.
+	n.WalkPath(k, func(lk []byte, v V) bool {
+		key, val, found = lk, v, true
+		return false
+	})
+	return key, val, found
+}
 
-// }
+// Maximum is used to return the maximum value in the tree
+func (n *APINode[V]) Maximum() ([]byte, V, bool) {
+	return leafResult(n.h.maxLeaf())
+}
 
-// func (n *APINode) Minimum() ([]byte, interface{}, bool) {
+// Minimum is used to return the minimum value in the tree
+func (n *APINode[V]) Minimum() ([]byte, V, bool) {
+	return leafResult(n.h.minLeaf())
+}
 
-// }
+// MaximumPrefix is used to return the maximum key and value that start with
+// prefix.
+func (n *APINode[V]) MaximumPrefix(prefix []byte) ([]byte, V, bool) {
+	return leafResult(n.h.seekPrefix(prefix).maxLeaf())
+}
 
-// func (n *APINode) Walk(fn WalkFn) {
+// MinimumPrefix is used to return the minimum key and value that start with
+// prefix.
+func (n *APINode[V]) MinimumPrefix(prefix []byte) ([]byte, V, bool) {
+	return leafResult(n.h.seekPrefix(prefix).minLeaf())
+}
 
-// }
+// Walk is used to walk the tree in order, invoking fn for every leaf until it
+// returns true.
+func (n *APINode[V]) Walk(fn WalkFn[V]) {
+	walkIterator(n.Iterator(), fn)
+}
 
-// func (n *APINode) WalkPath(path []byte, fn WalkFn) {
+// WalkPrefix is used to walk the tree under a prefix in order, invoking fn for
+// every leaf until it returns true.
+func (n *APINode[V]) WalkPrefix(prefix []byte, fn WalkFn[V]) {
+	it := n.Iterator()
+	it.SeekPrefix(prefix)
+	walkIterator(it, fn)
+}
 
-// }
+// WalkPath is used to walk the tree, but only visiting nodes from the root
+// down to a given leaf. Where WalkPrefix walks all the entries *under* the
+// given prefix, this walks the entries *above* the given prefix. fn is invoked
+// for every leaf whose key is a prefix of path, shortest first, until it
+// returns true.
+func (n *APINode[V]) WalkPath(path []byte, fn WalkFn[V]) {
+	h := n.h
+	depth := 0
+	for h != nil {
+		if h.typ == typLeaf {
+			leaf := h.leafNode()
+			if bytes.HasPrefix(path, leaf.key) {
+				fn(leaf.key, leaf.value)
+			}
+			return
+		}
+
+		// The prefix check may be optimistic but every leaf is checked against
+		// the path in full before it's visited.
+		if !h.checkPrefix(path, depth) {
+			return
+		}
+		pLen, _ := h.prefixFields()
+		depth += int(*pLen)
+
+		if leaf := h.innerLeaf(); leaf != nil && bytes.HasPrefix(path, leaf.key) {
+			if fn(leaf.key, leaf.value) {
+				return
+			}
+		}
+
+		if depth >= len(path) {
+			return
+		}
+		h = h.findChild(path[depth])
+		depth++
+	}
+}
 
-// func (n *APINode) WalkPrefix(prefix []byte, fn WalkFn) {
+// walkIterator invokes fn for each remaining entry in it until fn returns
+// true.
+func walkIterator[V any](it *Iterator[V], fn WalkFn[V]) {
+	for k, v, ok := it.Next(); ok; k, v, ok = it.Next() {
+		if fn(k, v) {
+			return
+		}
+	}
+}
 
-// }
+// leafResult returns the key and value of leaf in the form used by the public
+// API or false if it is nil.
+func leafResult[V any](leaf *leafNode[V]) ([]byte, V, bool) {
+	var zero V
+	if leaf == nil {
+		return nil, zero, false
+	}
+	return leaf.key, leaf.value, true
+}
@@ -0,0 +1,179 @@
+package art
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testWalkCollect returns a WalkFn that appends keys to got and stops once it
+// has seen limit keys, if limit is positive.
+func testWalkCollect(t *testing.T, got *[]string, limit int) WalkFn[any] {
+	return func(k []byte, v interface{}) bool {
+		require.Equal(t, string(k), v)
+		*got = append(*got, string(k))
+		return limit > 0 && len(*got) >= limit
+	}
+}
+
+func TestAPINodeWalk(t *testing.T) {
+	keys := testKeys()
+	sorted := append([]string(nil), keys...)
+	sort.Strings(sorted)
+
+	tree := testBuildTree(keys, 3)
+
+	var got []string
+	tree.Root().Walk(testWalkCollect(t, &got, 0))
+	require.Equal(t, sorted, got)
+
+	// Stop early
+	got = nil
+	tree.Root().Walk(testWalkCollect(t, &got, 5))
+	require.Equal(t, sorted[0:5], got)
+
+	// Empty tree
+	got = nil
+	New().Root().Walk(testWalkCollect(t, &got, 0))
+	require.Empty(t, got)
+}
+
+func TestAPINodeWalkPrefix(t *testing.T) {
+	keys := testKeys()
+	sorted := append([]string(nil), keys...)
+	sort.Strings(sorted)
+
+	tree := testBuildTree(keys, 4)
+
+	for _, p := range []string{"", "a", "b", "foo", "foo/", "wide/", "mid/",
+		testLongPrefix, testLongPrefix + "bb", "this/is/a/very/long/shared/prefiX"} {
+		t.Run(p, func(t *testing.T) {
+			var want []string
+			for _, k := range sorted {
+				if strings.HasPrefix(k, p) {
+					want = append(want, k)
+				}
+			}
+			var got []string
+			tree.Root().WalkPrefix([]byte(p), testWalkCollect(t, &got, 0))
+			require.Equal(t, want, got)
+
+			if len(want) > 1 {
+				got = nil
+				tree.Root().WalkPrefix([]byte(p), testWalkCollect(t, &got, 1))
+				require.Equal(t, want[0:1], got)
+			}
+		})
+	}
+}
+
+func TestAPINodeWalkPath(t *testing.T) {
+	keys := testKeys()
+	tree := testBuildTree(keys, 5)
+
+	paths := append(testSeekKeys(keys), "foo/bar/baz/qux", testLongPrefix+"bb/and/then/another/long/bit/more/and/more")
+	for _, path := range paths {
+		var want []string
+		for _, k := range keys {
+			if strings.HasPrefix(path, k) {
+				want = append(want, k)
+			}
+		}
+		// Prefixes of the same path sort shortest first
+		sort.Strings(want)
+
+		var got []string
+		tree.Root().WalkPath([]byte(path), testWalkCollect(t, &got, 0))
+		require.Equal(t, want, got, "path %q", path)
+
+		if len(want) > 1 {
+			got = nil
+			tree.Root().WalkPath([]byte(path), testWalkCollect(t, &got, 1))
+			require.Equal(t, want[0:1], got)
+		}
+	}
+}
+
+func TestAPINodeLongestPrefix(t *testing.T) {
+	keys := testKeys()
+	tree := testBuildTree(keys, 6)
+
+	cases := []struct {
+		in, want string
+		found    bool
+	}{
+		{"", "", true},
+		{"a", "a", true},
+		{"aaaaa", "aaa", true},
+		{"abc", "ab", true},
+		{"b", "", true},
+		{"foo/ba", "foo", true},
+		{"foo/bar/baz/qux", "foo/bar/baz", true},
+		{"foobarbaz", "foobar", true},
+		{testLongPrefix[0:20], "", true},
+		{testLongPrefix + "bx", testLongPrefix + "b", true},
+		{testLongPrefix + "bb/and/then/another/long/bi", testLongPrefix + "b", true},
+		{testLongPrefix + "bb/and/then/another/long/bit/mor", testLongPrefix + "bb/and/then/another/long/bit", true},
+		// Differs from the long prefix after maxPrefixLen bytes.
+		{"this/is/a/very/long/shared/prefiX/a", "", true},
+		{"wide/a/b/c", "wide/a", true},
+	}
+	for _, tc := range cases {
+		k, v, ok := tree.LongestPrefix([]byte(tc.in))
+		require.Equal(t, tc.found, ok, "input %q", tc.in)
+		require.Equal(t, tc.want, string(k), "input %q", tc.in)
+		require.Equal(t, tc.want, v, "input %q", tc.in)
+	}
+
+	// Without the empty key some inputs have no prefix at all
+	tree, _, _ = tree.Delete([]byte(""))
+	for _, in := range []string{"", "b", "this/is/a/very/long/shared/prefiX/a", testLongPrefix[0:20]} {
+		_, _, ok := tree.LongestPrefix([]byte(in))
+		require.False(t, ok, "input %q", in)
+	}
+}
+
+func TestAPINodeMinMax(t *testing.T) {
+	keys := testKeys()
+	sorted := append([]string(nil), keys...)
+	sort.Strings(sorted)
+
+	tree := testBuildTree(keys, 7)
+
+	k, v, ok := tree.Minimum()
+	require.True(t, ok)
+	require.Equal(t, sorted[0], string(k))
+	require.Equal(t, sorted[0], v)
+
+	k, v, ok = tree.Maximum()
+	require.True(t, ok)
+	require.Equal(t, sorted[len(sorted)-1], string(k))
+	require.Equal(t, sorted[len(sorted)-1], v)
+
+	for _, p := range []string{"", "a", "aa", "b", "foo", "foo/", "foo/bar/baz/",
+		"wide/", "mid/", testLongPrefix, testLongPrefix + "bb",
+		"this/is/a/very/long/shared/prefiX"} {
+		var want []string
+		for _, k := range sorted {
+			if strings.HasPrefix(k, p) {
+				want = append(want, k)
+			}
+		}
+
+		k, _, ok := tree.MinimumPrefix([]byte(p))
+		require.Equal(t, len(want) > 0, ok, "prefix %q", p)
+		k2, _, ok := tree.MaximumPrefix([]byte(p))
+		require.Equal(t, len(want) > 0, ok, "prefix %q", p)
+		if len(want) > 0 {
+			require.Equal(t, want[0], string(k), "prefix %q", p)
+			require.Equal(t, want[len(want)-1], string(k2), "prefix %q", p)
+		}
+	}
+
+	_, _, ok = New().Minimum()
+	require.False(t, ok)
+	_, _, ok = New().Maximum()
+	require.False(t, ok)
+}
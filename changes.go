@@ -0,0 +1,94 @@
+package art
+
+import (
+	"bytes"
+	"sort"
+)
+
+// Change describes the net effect of a transaction on a single key.
+type Change[V any] struct {
+	Key []byte
+
+	// Before is the value the key had in the snapshot the transaction started
+	// from and After is its value in the committed tree. Either is only
+	// meaningful if the key existed at that point, see Created and Deleted.
+	Before V
+	After  V
+
+	hadBefore bool
+	hasAfter  bool
+}
+
+// Created returns true if the key didn't exist before the transaction.
+func (c *Change[V]) Created() bool {
+	return !c.hadBefore && c.hasAfter
+}
+
+// Updated returns true if the key existed both before and after the
+// transaction.
+func (c *Change[V]) Updated() bool {
+	return c.hadBefore && c.hasAfter
+}
+
+// Deleted returns true if the key was removed by the transaction.
+func (c *Change[V]) Deleted() bool {
+	return c.hadBefore && !c.hasAfter
+}
+
+// TrackChanges can be used to toggle if the transaction records the keys it
+// writes so they can be listed with Changes. It should be enabled before any
+// writes are made since earlier ones are not recorded.
+func (t *Txn[V]) TrackChanges(track bool) {
+	t.trackChanges = track
+}
+
+// Changes returns the keys inserted, updated or deleted by the transaction so
+// far in key order. Each key appears once with the value it had before the
+// transaction and the value it has now, so a key that was written several
+// times is coalesced and a key that was created and deleted again is left
+// out. It returns nil unless TrackChanges was enabled.
+func (t *Txn[V]) Changes() []Change[V] {
+	if len(t.changes) == 0 {
+		return nil
+	}
+	changes := make([]Change[V], 0, len(t.changes))
+	for _, c := range t.changes {
+		if !c.hadBefore && !c.hasAfter {
+			continue
+		}
+		changes = append(changes, *c)
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return bytes.Compare(changes[i].Key, changes[j].Key) < 0
+	})
+	return changes
+}
+
+// recordDelete notes that k with value old was deleted.
+func (t *Txn[V]) recordDelete(k []byte, old V) {
+	var zero V
+	t.recordChange(k, old, true, zero, false)
+}
+
+// recordChange notes that k changed from old to v. existed and exists are
+// whether k was present before and after the write respectively. Only the
+// first old value for a key is kept since that is the one from the snapshot.
+func (t *Txn[V]) recordChange(k []byte, old V, existed bool, v V, exists bool) {
+	if !t.trackChanges {
+		return
+	}
+	if t.changes == nil {
+		t.changes = make(map[string]*Change[V])
+	}
+	c, ok := t.changes[string(k)]
+	if !ok {
+		c = &Change[V]{
+			Key:       k,
+			Before:    old,
+			hadBefore: existed,
+		}
+		t.changes[string(k)] = c
+	}
+	c.After = v
+	c.hasAfter = exists
+}
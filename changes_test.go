@@ -0,0 +1,78 @@
+package art
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTxnChanges(t *testing.T) {
+	require := require.New(t)
+
+	tree := New()
+	for _, k := range []string{"foo", "foo/bar", "foo/baz", "zip", "zap"} {
+		tree, _, _ = tree.Insert([]byte(k), k)
+	}
+
+	txn := tree.Txn()
+	txn.TrackChanges(true)
+
+	// Updated twice, should only show the original and final values
+	txn.Insert([]byte("zip"), 1)
+	txn.Insert([]byte("zip"), 2)
+
+	// Created
+	txn.Insert([]byte("new"), 3)
+
+	// Created then deleted, should not show at all
+	txn.Insert([]byte("temp"), 4)
+	txn.Delete([]byte("temp"))
+
+	// Deleted then created again is an update
+	txn.Delete([]byte("zap"))
+	txn.Insert([]byte("zap"), 5)
+
+	// Created then removed by the prefix delete along with existing keys
+	txn.Insert([]byte("foo/new"), 6)
+	require.True(txn.DeletePrefix([]byte("foo/")))
+
+	// Misses don't record anything
+	txn.Delete([]byte("missing"))
+	txn.DeletePrefix([]byte("nope"))
+
+	txn.Commit()
+
+	type change struct {
+		key           string
+		before, after interface{}
+		created       bool
+		updated       bool
+		deleted       bool
+	}
+	want := []change{
+		{key: "foo/bar", before: "foo/bar", deleted: true},
+		{key: "foo/baz", before: "foo/baz", deleted: true},
+		{key: "new", after: 3, created: true},
+		{key: "zap", before: "zap", after: 5, updated: true},
+		{key: "zip", before: "zip", after: 2, updated: true},
+	}
+	var got []change
+	for _, c := range txn.Changes() {
+		got = append(got, change{
+			key:     string(c.Key),
+			before:  c.Before,
+			after:   c.After,
+			created: c.Created(),
+			updated: c.Updated(),
+			deleted: c.Deleted(),
+		})
+	}
+	require.Equal(want, got)
+}
+
+func TestTxnChangesDisabled(t *testing.T) {
+	txn := New().Txn()
+	txn.Insert([]byte("foo"), 1)
+	txn.Commit()
+	require.Nil(t, txn.Changes())
+}
@@ -0,0 +1,155 @@
+package art
+
+import (
+	"bytes"
+)
+
+// DiffIterator iterates over the keys that differ between two trees in key
+// order. Each difference is reported as a Change from the first tree to the
+// second.
+type DiffIterator[V any] struct {
+	// a and b are stacks of the subtrees still to be compared with the next in
+	// key order on top. A subtree is only expanded into its inner leaf and
+	// children if it can't be skipped or reported whole.
+	a, b []*nodeHeader[V]
+
+	// expanded counts the inner nodes expanded so far.
+	expanded int
+}
+
+// Diff returns an iterator over the keys that were added, removed or modified
+// between trees a and b.
+//
+// The trees are walked together and any subtree that is the same node in both
+// is skipped without looking inside, so diffing two versions of the same tree
+// costs roughly the size of the change rather than the size of the trees.
+// Nodes are compared by pointer rather than ID since transactions started from
+// the same tree can reuse IDs for different nodes. Any two trees can be
+// diffed, though unrelated ones share nothing and so are compared in full.
+//
+// A key is reported as modified if its leaf was replaced even if the new value
+// is equal to the old one.
+func Diff[V any](a, b *Tree[V]) *DiffIterator[V] {
+	d := &DiffIterator[V]{}
+	if a.root != nil {
+		d.a = append(d.a, a.root)
+	}
+	if b.root != nil {
+		d.b = append(d.b, b.root)
+	}
+	return d
+}
+
+// Next returns the next difference. The final return is false once there are
+// no more.
+func (d *DiffIterator[V]) Next() (Change[V], bool) {
+	for len(d.a) > 0 || len(d.b) > 0 {
+		if len(d.a) == 0 {
+			if n := d.pop(&d.b); n != nil {
+				return Change[V]{Key: n.key, After: n.value, hasAfter: true}, true
+			}
+			continue
+		}
+		if len(d.b) == 0 {
+			if n := d.pop(&d.a); n != nil {
+				return Change[V]{Key: n.key, Before: n.value, hadBefore: true}, true
+			}
+			continue
+		}
+
+		na, nb := d.a[len(d.a)-1], d.b[len(d.b)-1]
+		if na == nb {
+			// Shared subtree, nothing in it can differ.
+			d.a = d.a[:len(d.a)-1]
+			d.b = d.b[:len(d.b)-1]
+			continue
+		}
+
+		if na.typ == typLeaf && nb.typ == typLeaf {
+			la, lb := na.leafNode(), nb.leafNode()
+			switch bytes.Compare(la.key, lb.key) {
+			case -1:
+				d.a = d.a[:len(d.a)-1]
+				return Change[V]{Key: la.key, Before: la.value, hadBefore: true}, true
+			case 1:
+				d.b = d.b[:len(d.b)-1]
+				return Change[V]{Key: lb.key, After: lb.value, hasAfter: true}, true
+			}
+			d.a = d.a[:len(d.a)-1]
+			d.b = d.b[:len(d.b)-1]
+			return Change[V]{
+				Key:       la.key,
+				Before:    la.value,
+				After:     lb.value,
+				hadBefore: true,
+				hasAfter:  true,
+			}, true
+		}
+
+		// At least one is an inner node. Expand whichever covers the other's
+		// range, or the one that starts first if they don't overlap. Expanding
+		// only the one that starts first (or the wider one if they start
+		// together) means a node that's shared is never expanded, since the
+		// other stream must reach it first by expanding its ancestors or passing
+		// smaller keys.
+		switch bytes.Compare(na.minLeaf().key, nb.minLeaf().key) {
+		case -1:
+			if leaf := d.pop(&d.a); leaf != nil {
+				return Change[V]{Key: leaf.key, Before: leaf.value, hadBefore: true}, true
+			}
+		case 1:
+			if leaf := d.pop(&d.b); leaf != nil {
+				return Change[V]{Key: leaf.key, After: leaf.value, hasAfter: true}, true
+			}
+		default:
+			switch bytes.Compare(na.maxLeaf().key, nb.maxLeaf().key) {
+			case -1:
+				d.expand(&d.b)
+			case 1:
+				d.expand(&d.a)
+			default:
+				d.expand(&d.a)
+				d.expand(&d.b)
+			}
+		}
+	}
+	return Change[V]{}, false
+}
+
+// pop returns the leaf on top of stack if it is one, otherwise it expands the
+// inner node there and returns nil.
+func (d *DiffIterator[V]) pop(stack *[]*nodeHeader[V]) *leafNode[V] {
+	n := (*stack)[len(*stack)-1]
+	if n.typ != typLeaf {
+		d.expand(stack)
+		return nil
+	}
+	*stack = (*stack)[:len(*stack)-1]
+	return n.leafNode()
+}
+
+// expand replaces the inner node on top of stack with its children and inner
+// leaf, keeping the smallest key on top.
+func (d *DiffIterator[V]) expand(stack *[]*nodeHeader[V]) {
+	n := (*stack)[len(*stack)-1]
+	*stack = (*stack)[:len(*stack)-1]
+	d.expanded++
+
+	// Children are found in ascending order so push them in reverse after.
+	start := len(*stack)
+	for c := 0; c < 256; {
+		edge, child := n.lowerBound(c)
+		if child == nil {
+			break
+		}
+		*stack = append(*stack, child)
+		c = edge + 1
+	}
+	s := (*stack)[start:]
+	for i, j := 0, len(s)-1; i < j; i, j = i+1, j-1 {
+		s[i], s[j] = s[j], s[i]
+	}
+	if leaf := n.innerLeaf(); leaf != nil {
+		*stack = append(*stack, &leaf.nodeHeader)
+	}
+}
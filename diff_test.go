@@ -0,0 +1,131 @@
+package art
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testDiffEntry is a Change flattened so it can be compared with require.
+type testDiffEntry struct {
+	key           string
+	before, after interface{}
+	created       bool
+	updated       bool
+	deleted       bool
+}
+
+func testDiffCollect(d *DiffIterator[any]) []testDiffEntry {
+	var got []testDiffEntry
+	for c, ok := d.Next(); ok; c, ok = d.Next() {
+		got = append(got, testDiffEntry{
+			key:     string(c.Key),
+			before:  c.Before,
+			after:   c.After,
+			created: c.Created(),
+			updated: c.Updated(),
+			deleted: c.Deleted(),
+		})
+	}
+	return got
+}
+
+// testDiffNaive compares every key of both trees. Any key present in both
+// with a different leaf is modified.
+func testDiffNaive(a, b *Tree[any]) []testDiffEntry {
+	keys := make(map[string]struct{})
+	for _, tree := range []*Tree[any]{a, b} {
+		it := tree.Root().Iterator()
+		for k, _, ok := it.Next(); ok; k, _, ok = it.Next() {
+			keys[string(k)] = struct{}{}
+		}
+	}
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+
+	var want []testDiffEntry
+	for _, k := range sorted {
+		la, lb := a.root.findLeaf([]byte(k)), b.root.findLeaf([]byte(k))
+		switch {
+		case la == lb:
+		case la == nil:
+			want = append(want, testDiffEntry{key: k, after: lb.value, created: true})
+		case lb == nil:
+			want = append(want, testDiffEntry{key: k, before: la.value, deleted: true})
+		default:
+			want = append(want, testDiffEntry{key: k, before: la.value, after: lb.value, updated: true})
+		}
+	}
+	return want
+}
+
+func TestDiff(t *testing.T) {
+	keys := testKeys()
+
+	for seed := int64(0); seed < 20; seed++ {
+		t.Run(fmt.Sprintf("seed-%d", seed), func(t *testing.T) {
+			require := require.New(t)
+			r := rand.New(rand.NewSource(seed))
+
+			// Build a lineage of versions with a few random writes in each.
+			versions := []*Tree[any]{New()}
+			tree := versions[0]
+			for i := 0; i < 30; i++ {
+				txn := tree.Txn()
+				for j := 0; j < r.Intn(20)+1; j++ {
+					k := keys[r.Intn(len(keys))]
+					switch op := r.Intn(10); {
+					case op < 6:
+						txn.Insert([]byte(k), fmt.Sprintf("%s-%d", k, i))
+					case op < 9:
+						txn.Delete([]byte(k))
+					default:
+						txn.DeletePrefix([]byte(k[0:r.Intn(len(k)+1)]))
+					}
+				}
+				tree = txn.Commit()
+				versions = append(versions, tree)
+			}
+
+			for i := 0; i < 30; i++ {
+				a := versions[r.Intn(len(versions))]
+				b := versions[r.Intn(len(versions))]
+				require.Equal(testDiffNaive(a, b), testDiffCollect(Diff(a, b)))
+			}
+
+			// Unrelated trees with the same keys differ in every value
+			other := testBuildTree(keys, seed)
+			require.Equal(testDiffNaive(tree, other), testDiffCollect(Diff(tree, other)))
+		})
+	}
+}
+
+func TestDiffEmpty(t *testing.T) {
+	require := require.New(t)
+
+	tree := testBuildTree(testKeys(), 1)
+	require.Empty(testDiffCollect(Diff(New(), New())))
+	require.Empty(testDiffCollect(Diff(tree, tree)))
+	require.Len(testDiffCollect(Diff(New(), tree)), len(testKeys()))
+	require.Len(testDiffCollect(Diff(tree, New())), len(testKeys()))
+}
+
+func TestDiffSkipsSharedSubtrees(t *testing.T) {
+	require := require.New(t)
+
+	a := testBuildTree(testKeys(), 1)
+	b, _, _ := a.Insert([]byte("wide/a/new"), 1)
+
+	d := Diff(a, b)
+	got := testDiffCollect(d)
+	require.Equal([]testDiffEntry{{key: "wide/a/new", after: 1, created: true}}, got)
+
+	// Only the path to the change should have been expanded, in each tree.
+	require.LessOrEqual(d.expanded, 6)
+}
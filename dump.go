@@ -32,8 +32,8 @@ import (
 // 		   └── Leaf (0xc8200f50a0)
 // 		       key: "bar"
 // 		       val: "bar"
-type dumper struct {
-	root        *nodeHeader
+type dumper[V any] struct {
+	root        *nodeHeader[V]
 	buf         *bytes.Buffer
 	nChildStack []int
 	innerLeaf   bool
@@ -41,25 +41,25 @@ type dumper struct {
 
 // Dump returns the human readable debug output of a radix node and it's
 // children recursively.
-func Dump(root *nodeHeader) string {
-	d := &dumper{root: root}
+func Dump[V any](root *nodeHeader[V]) string {
+	d := &dumper[V]{root: root}
 	return d.String()
 }
 
-func (d *dumper) String() string {
+func (d *dumper[V]) String() string {
 	d.buf = bytes.NewBufferString("")
 	d.dumpNode(d.root)
 	return d.buf.String()
 }
 
-func (d *dumper) isLastChild() bool {
+func (d *dumper[V]) isLastChild() bool {
 	if len(d.nChildStack) < 1 {
 		return true
 	}
 	return d.nChildStack[len(d.nChildStack)-1] == 1
 }
 
-func (d *dumper) padding() (string, string) {
+func (d *dumper[V]) padding() (string, string) {
 	depth := len(d.nChildStack)
 	if depth == 0 {
 		return "───", "   "
@@ -82,25 +82,25 @@ func (d *dumper) padding() (string, string) {
 	return pad + head, pad + finalPad
 }
 
-func (d *dumper) pushNChildren(n int) {
+func (d *dumper[V]) pushNChildren(n int) {
 	d.nChildStack = append(d.nChildStack, n)
 }
 
-func (d *dumper) decNChildren() {
+func (d *dumper[V]) decNChildren() {
 	if len(d.nChildStack) < 1 {
 		return
 	}
 	d.nChildStack[len(d.nChildStack)-1]--
 }
 
-func (d *dumper) popNChildren() {
+func (d *dumper[V]) popNChildren() {
 	depth := len(d.nChildStack)
 	if depth > 0 {
 		d.nChildStack = d.nChildStack[0 : depth-1]
 	}
 }
 
-func (d *dumper) dumpIndexArray(a []byte, n int) {
+func (d *dumper[V]) dumpIndexArray(a []byte, n int) {
 	d.buf.WriteRune('[')
 	for i, c := range a {
 		if i < n {
@@ -115,7 +115,7 @@ func (d *dumper) dumpIndexArray(a []byte, n int) {
 	d.buf.WriteRune(']')
 }
 
-func (d *dumper) dumpIndex48(a []byte) {
+func (d *dumper[V]) dumpIndex48(a []byte) {
 	d.buf.WriteRune('{')
 	for i := 0; i < 256; i++ {
 		if a[i] != 0x0 {
@@ -125,7 +125,7 @@ func (d *dumper) dumpIndex48(a []byte) {
 	d.buf.WriteString(" }")
 }
 
-func (d *dumper) dumpIndex256(a []*nodeHeader) {
+func (d *dumper[V]) dumpIndex256(a []*nodeHeader[V]) {
 	d.buf.WriteRune('{')
 	for i := 0; i < 256; i++ {
 		if a[i] != nil {
@@ -135,7 +135,7 @@ func (d *dumper) dumpIndex256(a []*nodeHeader) {
 	d.buf.WriteString(" }")
 }
 
-func (d *dumper) dumpInnerNode(pad string, n *innerNodeHeader) {
+func (d *dumper[V]) dumpInnerNode(pad string, n *innerNodeHeader[V]) {
 	fmt.Fprintf(d.buf, "%s id:         %d\n", pad, n.id)
 	fmt.Fprintf(d.buf, "%s prefix(%d): %q\n", pad, n.prefixLen,
 		string(n.prefix[0:minU16(n.prefixLen, maxPrefixLen)]))
@@ -151,7 +151,7 @@ func (d *dumper) dumpInnerNode(pad string, n *innerNodeHeader) {
 	}
 }
 
-func (d *dumper) dumpChildren(pad string, nChildren int, children []*nodeHeader) {
+func (d *dumper[V]) dumpChildren(pad string, nChildren int, children []*nodeHeader[V]) {
 	fmt.Fprintf(d.buf, "%s children: %v\n", pad, children)
 
 	d.pushNChildren(nChildren)
@@ -166,7 +166,7 @@ func (d *dumper) dumpChildren(pad string, nChildren int, children []*nodeHeader)
 	d.popNChildren()
 }
 
-func (d *dumper) dumpNode(n *nodeHeader) {
+func (d *dumper[V]) dumpNode(n *nodeHeader[V]) {
 	headerPad, pad := d.padding()
 
 	switch n.typ {
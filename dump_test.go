@@ -90,14 +90,14 @@ func TestDumper(t *testing.T) {
 				art, _, ok = art.Insert([]byte(kv.k), kv.v)
 				require.False(ok)
 
-				d := dumper{
+				d := dumper[any]{
 					root: art.root,
 				}
 				got := d.String()
 				t.Logf("JUST INSERTED %s\n%s", kv.k, got)
 			}
 
-			d := dumper{
+			d := dumper[any]{
 				root: art.root,
 			}
 
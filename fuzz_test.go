@@ -0,0 +1,367 @@
+package art
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// Fuzz inputs are a sequence of operations. Each starts with an op byte
+// followed, for ops that need one, by a key header byte and then the key
+// bytes. The low 6 bits of the header are the number of key bytes that follow.
+// If the fuzzHeaderExtend bit is set those bytes are appended to the previous
+// key rather than replacing it which makes keys that are prefixes of each other
+// and long shared prefixes easy for the fuzzer to find.
+const (
+	fuzzOpInsert = iota
+	fuzzOpDelete
+	fuzzOpDeletePrefix
+	fuzzOpGet
+	fuzzOpIterate
+	fuzzOpCommit
+	fuzzNumOps
+
+	fuzzHeaderExtend  = 0x40
+	fuzzHeaderLenMask = 0x3f
+
+	// Every commit checks the whole tree so the cost of an input grows with the
+	// square of its length, and the fuzzer minimizes each new input by trying
+	// it without every subsequence of its bytes. Bytes past fuzzMaxLen are
+	// ignored so inputs stay quick to run and the minimizer can cut them short.
+	// FuzzTree fails if a seed doesn't fit.
+	fuzzMaxLen = 256
+
+	// At most fuzzMaxSnapshots commits are kept and checked again at the end.
+	// The most recent fuzzRecentSnapshots are always kept since their nodes
+	// were copied most recently, the rest are a sample spread evenly over every
+	// commit.
+	fuzzMaxSnapshots    = 16
+	fuzzRecentSnapshots = 4
+)
+
+// fuzzModel is the reference the tree is compared against, just a map that is
+// sorted whenever order matters.
+type fuzzModel map[string]int
+
+func (m fuzzModel) clone() fuzzModel {
+	c := make(fuzzModel, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+func (m fuzzModel) sortedKeys() []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// fuzzSnapshot is a committed tree and a copy of the model when it was made.
+type fuzzSnapshot struct {
+	tree  *Tree[int]
+	model fuzzModel
+}
+
+// fuzzSampler keeps a bounded sample of snapshots to check again at the end.
+type fuzzSampler struct {
+	n      int
+	stride int
+
+	// sampled holds every stride'th snapshot, starting with the first.
+	sampled []fuzzSnapshot
+	recent  []fuzzSnapshot
+}
+
+func (s *fuzzSampler) add(snap fuzzSnapshot) {
+	if s.n%s.stride == 0 {
+		s.sampled = append(s.sampled, snap)
+		if len(s.sampled) > fuzzMaxSnapshots-fuzzRecentSnapshots {
+			// Every other one is on the doubled stride.
+			kept := s.sampled[0:0]
+			for i := 0; i < len(s.sampled); i += 2 {
+				kept = append(kept, s.sampled[i])
+			}
+			s.sampled = kept
+			s.stride *= 2
+		}
+	}
+	s.n++
+
+	s.recent = append(s.recent, snap)
+	if len(s.recent) > fuzzRecentSnapshots {
+		s.recent = s.recent[1:]
+	}
+}
+
+// all returns every kept snapshot once.
+func (s *fuzzSampler) all() []fuzzSnapshot {
+	all := append([]fuzzSnapshot(nil), s.sampled...)
+	sampled := make(map[*Tree[int]]bool, len(s.sampled))
+	for _, snap := range s.sampled {
+		sampled[snap.tree] = true
+	}
+	for _, snap := range s.recent {
+		if !sampled[snap.tree] {
+			all = append(all, snap)
+		}
+	}
+	return all
+}
+
+// fuzzCheckIter compares everything an iterator over the tree returns with
+// the model's keys that start with prefix and are at least lower in order.
+func fuzzCheckIter(t *testing.T, it *Iterator[int], m fuzzModel, prefix, lower string) {
+	t.Helper()
+	for _, k := range m.sortedKeys() {
+		if len(k) < len(prefix) || k[0:len(prefix)] != prefix || k < lower {
+			continue
+		}
+		got, v, ok := it.Next()
+		if !ok {
+			t.Fatalf("iterator ended early, expected %q", k)
+		}
+		if string(got) != k || v != m[k] {
+			t.Fatalf("iterator returned %q=%d, expected %q=%d", got, v, k, m[k])
+		}
+	}
+	if got, _, ok := it.Next(); ok {
+		t.Fatalf("iterator returned extra key %q", got)
+	}
+}
+
+// fuzzCheckTree compares the whole contents of tree with the model.
+func fuzzCheckTree(t *testing.T, tree *Tree[int], m fuzzModel) {
+	t.Helper()
+	if tree.Len() != len(m) {
+		t.Fatalf("tree has Len %d, expected %d", tree.Len(), len(m))
+	}
+	if err := tree.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	fuzzCheckIter(t, tree.Root().Iterator(), m, "", "")
+
+	keys := m.sortedKeys()
+	ri := tree.Root().ReverseIterator()
+	for i := len(keys) - 1; i >= 0; i-- {
+		got, _, ok := ri.Previous()
+		if !ok || string(got) != keys[i] {
+			t.Fatalf("reverse iterator returned %q, expected %q", got, keys[i])
+		}
+	}
+	if got, _, ok := ri.Previous(); ok {
+		t.Fatalf("reverse iterator returned extra key %q", got)
+	}
+}
+
+// fuzzExtend is a key for fuzzEncode that extends the previous key.
+type fuzzExtend string
+
+// fuzzEncode builds a fuzz input from ops and keys for the seed corpus.
+func fuzzEncode(ops ...interface{}) []byte {
+	var buf []byte
+	for _, op := range ops {
+		switch op := op.(type) {
+		case int:
+			buf = append(buf, byte(op))
+		case string:
+			buf = append(buf, byte(len(op)))
+			buf = append(buf, op...)
+		case fuzzExtend:
+			buf = append(buf, fuzzHeaderExtend|byte(len(op)))
+			buf = append(buf, op...)
+		}
+	}
+	return buf
+}
+
+func FuzzTree(f *testing.F) {
+	add := func(seed []byte) {
+		f.Helper()
+		if len(seed) > fuzzMaxLen {
+			f.Fatalf("seed is %d bytes, the fuzz target ignores all but %d", len(seed), fuzzMaxLen)
+		}
+		f.Add(seed)
+	}
+
+	// Insert the shorter test keys then delete and re-add some, committing along
+	// the way. testKeys includes keys that are prefixes of each other. The
+	// "wide/" keys and long prefixes have seeds of their own below, and only
+	// enough "mid/" keys for a node16 are used, to keep each under fuzzMaxLen.
+	var ops []interface{}
+	numMid := 0
+	for i, k := range testKeys() {
+		if strings.HasPrefix(k, "wide/") || strings.HasPrefix(k, testLongPrefix) {
+			continue
+		}
+		if strings.HasPrefix(k, "mid/") {
+			if numMid++; numMid > 10 {
+				continue
+			}
+		}
+		ops = append(ops, fuzzOpInsert, k)
+		if i%7 == 0 {
+			ops = append(ops, fuzzOpCommit)
+		}
+	}
+	add(fuzzEncode(append(ops,
+		fuzzOpDelete, "foo", fuzzOpDelete, "aa", fuzzOpCommit,
+		fuzzOpDeletePrefix, "mid/", fuzzOpIterate, "foo",
+		fuzzOpInsert, "mid/", fuzzOpCommit, fuzzOpIterate, "")...))
+
+	// Enough children under one node to grow it to a node256 then shrink it
+	// back down.
+	ops = nil
+	for i, c := range allTheBytes[0:50] {
+		ops = append(ops, fuzzOpInsert, string([]byte{'w', c}))
+		if i%10 == 0 {
+			ops = append(ops, fuzzOpCommit)
+		}
+	}
+	add(fuzzEncode(append(ops, fuzzOpDelete, "wZ", fuzzOpCommit,
+		fuzzOpDeletePrefix, "w")...))
+
+	// Keys that extend each other one byte at a time.
+	chain := []byte{fuzzOpInsert, 1, 'a'}
+	for i := 0; i < 30; i++ {
+		chain = append(chain, fuzzOpInsert, fuzzHeaderExtend|1, byte('a'+i%3))
+		if i%5 == 0 {
+			chain = append(chain, fuzzOpCommit, fuzzOpDelete, fuzzHeaderExtend|0)
+		}
+	}
+	add(chain)
+
+	// Keys that share prefixes longer than maxPrefixLen, splitting and
+	// extending them.
+	add(fuzzEncode(fuzzOpInsert, testLongPrefix, fuzzOpInsert, fuzzExtend("a"),
+		fuzzOpInsert, testLongPrefix+"bb/and/then/another/long/bit",
+		fuzzOpInsert, fuzzExtend("/more"), fuzzOpCommit,
+		fuzzOpInsert, testLongPrefix+"b", fuzzOpInsert, fuzzExtend("a"),
+		fuzzOpDeletePrefix, testLongPrefix+"b", fuzzOpIterate, testLongPrefix))
+
+	// The same long prefix then a split within it.
+	add(fuzzEncode(fuzzOpInsert, testLongPrefix+"x", fuzzOpInsert, testLongPrefix+"y",
+		fuzzOpCommit, fuzzOpInsert, "this/is/a/", fuzzOpInsert, "this/is/a/very/lonG",
+		fuzzOpDeletePrefix, "this/is/a/very", fuzzOpIterate, "this"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if len(data) > fuzzMaxLen {
+			data = data[0:fuzzMaxLen]
+		}
+		tree := NewTree[int]()
+		txn := tree.Txn()
+		model := make(fuzzModel)
+		snaps := &fuzzSampler{stride: 1}
+		snaps.add(fuzzSnapshot{tree: tree, model: model.clone()})
+
+		var key []byte
+		readKey := func() bool {
+			if len(data) == 0 {
+				return false
+			}
+			hdr := data[0]
+			n := int(hdr & fuzzHeaderLenMask)
+			data = data[1:]
+			if n > len(data) {
+				n = len(data)
+			}
+			if hdr&fuzzHeaderExtend == 0 {
+				key = nil
+			}
+			// Always copy since the tree keeps the key.
+			key = append(append([]byte(nil), key...), data[0:n]...)
+			data = data[n:]
+			return true
+		}
+
+		for i := 0; len(data) > 0; i++ {
+			op := data[0] % fuzzNumOps
+			data = data[1:]
+			if op != fuzzOpCommit && !readKey() {
+				break
+			}
+			k := string(key)
+
+			switch op {
+			case fuzzOpInsert:
+				old, ok := txn.Insert(key, i)
+				want, wantOK := model[k]
+				if ok != wantOK || old != want {
+					t.Fatalf("insert %q returned %d %v, expected %d %v", key, old, ok, want, wantOK)
+				}
+				model[k] = i
+
+			case fuzzOpDelete:
+				old, ok := txn.Delete(key)
+				want, wantOK := model[k]
+				if ok != wantOK || old != want {
+					t.Fatalf("delete %q returned %d %v, expected %d %v", key, old, ok, want, wantOK)
+				}
+				delete(model, k)
+
+			case fuzzOpDeletePrefix:
+				wantOK := false
+				for mk := range model {
+					if len(mk) >= len(k) && mk[0:len(k)] == k {
+						delete(model, mk)
+						wantOK = true
+					}
+				}
+				if ok := txn.DeletePrefix(key); ok != wantOK {
+					t.Fatalf("delete prefix %q returned %v, expected %v", key, ok, wantOK)
+				}
+
+			case fuzzOpGet:
+				v, ok := txn.Get(key)
+				want, wantOK := model[k]
+				if ok != wantOK || v != want {
+					t.Fatalf("get %q returned %d %v, expected %d %v", key, v, ok, want, wantOK)
+				}
+
+			case fuzzOpIterate:
+				it := txn.Root().Iterator()
+				it.SeekPrefix(key)
+				fuzzCheckIter(t, it, model, k, "")
+
+				it = txn.Root().Iterator()
+				it.SeekLowerBound(key)
+				fuzzCheckIter(t, it, model, "", k)
+
+				longest, _, ok := txn.Root().LongestPrefix(key)
+				want := ""
+				wantOK := false
+				for mk := range model {
+					if bytes.HasPrefix(key, []byte(mk)) && (!wantOK || len(mk) > len(want)) {
+						want, wantOK = mk, true
+					}
+				}
+				if ok != wantOK || string(longest) != want {
+					t.Fatalf("longest prefix of %q returned %q %v, expected %q %v",
+						key, longest, ok, want, wantOK)
+				}
+
+			case fuzzOpCommit:
+				tree = txn.Commit()
+				fuzzCheckTree(t, tree, model)
+				snaps.add(fuzzSnapshot{tree: tree, model: model.clone()})
+				txn = tree.Txn()
+			}
+
+			if txn.Len() != len(model) {
+				t.Fatalf("txn has Len %d after op %d, expected %d", txn.Len(), i, len(model))
+			}
+		}
+
+		tree = txn.Commit()
+		fuzzCheckTree(t, tree, model)
+
+		// Every old snapshot must still hold exactly what it did when committed.
+		for _, s := range snaps.all() {
+			fuzzCheckTree(t, s.tree, s.model)
+		}
+	})
+}
@@ -0,0 +1,130 @@
+package art
+
+import (
+	"bytes"
+)
+
+// Iterator is used to iterate over a set of nodes in lexicographic order of
+// their keys. An inner leaf is always visited before any of the children of
+// the same node since its key is a prefix of all of theirs.
+type Iterator[V any] struct {
+	node  *nodeHeader[V]
+	stack []iterFrame[V]
+}
+
+// iterFrame is the state of iteration through a single node. For leaves it is
+// only ever pushed and popped. For inner nodes next is the lowest next byte of
+// the children that are still to be visited, or -1 if the inner leaf hasn't
+// been visited yet.
+type iterFrame[V any] struct {
+	n    *nodeHeader[V]
+	next int
+}
+
+// reset positions the iterator back at the start of the whole subtree.
+func (i *Iterator[V]) reset() {
+	i.stack = i.stack[:0]
+	if i.node != nil {
+		i.push(i.node)
+	}
+}
+
+func (i *Iterator[V]) push(n *nodeHeader[V]) {
+	i.stack = append(i.stack, iterFrame[V]{n: n, next: -1})
+}
+
+// SeekPrefix is used to seek the iterator to a given prefix. Subsequent calls
+// to Next will return only keys that start with prefix.
+func (i *Iterator[V]) SeekPrefix(prefix []byte) {
+	i.stack = i.stack[:0]
+	if n := i.node.seekPrefix(prefix); n != nil {
+		i.push(n)
+	}
+}
+
+// SeekLowerBound is used to seek the iterator to the smallest key that is
+// greater or equal to the given key.
+func (i *Iterator[V]) SeekLowerBound(key []byte) {
+	i.stack = i.stack[:0]
+	n := i.node
+	depth := 0
+	for n != nil {
+		if n.typ == typLeaf {
+			if bytes.Compare(n.leafNode().key, key) >= 0 {
+				i.push(n)
+			}
+			return
+		}
+
+		// Compare the node prefix with the same number of bytes of the key. The
+		// whole prefix is needed since a mismatch in any byte decides the order
+		// of the whole subtree.
+		nodePrefix := n.prefix(depth)
+		remaining := key[depth:]
+		if len(remaining) > len(nodePrefix) {
+			remaining = remaining[0:len(nodePrefix)]
+		}
+		switch bytes.Compare(nodePrefix, remaining) {
+		case 1:
+			// Every key in this subtree is greater than the search key.
+			i.push(n)
+			return
+		case -1:
+			// Every key in this subtree is less than the search key so nothing
+			// here. Any frames already on the stack hold the larger keys.
+			return
+		}
+		depth += len(nodePrefix)
+
+		if depth >= len(key) {
+			// The search key ends within or at the end of the prefix so all keys
+			// below here, including the inner leaf, are greater or equal.
+			i.push(n)
+			return
+		}
+
+		// The inner leaf is shorter than the search key so sorts before it and is
+		// skipped. Children with a higher next byte all sort after it and will be
+		// visited once the child matching the next byte exactly (if any) is
+		// exhausted.
+		c := key[depth]
+		i.stack = append(i.stack, iterFrame[V]{n: n, next: int(c) + 1})
+
+		n = n.findChild(c)
+		depth++
+	}
+}
+
+// Next returns the next key and value in order. The final return is false
+// once the iteration is exhausted.
+func (i *Iterator[V]) Next() ([]byte, V, bool) {
+	var zero V
+	for len(i.stack) > 0 {
+		f := &i.stack[len(i.stack)-1]
+
+		if f.n.typ == typLeaf {
+			i.stack = i.stack[:len(i.stack)-1]
+			leaf := f.n.leafNode()
+			return leaf.key, leaf.value, true
+		}
+
+		if f.next < 0 {
+			// Inner leaf sorts before all children.
+			f.next = 0
+			if leaf := f.n.innerLeaf(); leaf != nil {
+				return leaf.key, leaf.value, true
+			}
+		}
+
+		edge, child := f.n.lowerBound(f.next)
+		if child == nil {
+			// Node exhausted
+			i.stack = i.stack[:len(i.stack)-1]
+			continue
+		}
+		// Update the frame before pushing since that might move the stack.
+		f.next = edge + 1
+		i.push(child)
+	}
+	return nil, zero, false
+}
@@ -0,0 +1,165 @@
+package art
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testBuildTree inserts every key into a new tree with the key as the value in
+// a random order.
+func testBuildTree(keys []string, seed int64) *Tree[any] {
+	shuffled := append([]string(nil), keys...)
+	r := rand.New(rand.NewSource(seed))
+	r.Shuffle(len(shuffled), func(i, j int) {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	})
+	txn := New().Txn()
+	for _, k := range shuffled {
+		txn.Insert([]byte(k), k)
+	}
+	return txn.Commit()
+}
+
+// testCollect drains an iterator into a slice of keys checking that the
+// values match.
+func testCollect(t *testing.T, next func() ([]byte, interface{}, bool)) []string {
+	t.Helper()
+	var got []string
+	for k, v, ok := next(); ok; k, v, ok = next() {
+		require.Equal(t, string(k), v)
+		got = append(got, string(k))
+	}
+	return got
+}
+
+func TestIteratorNext(t *testing.T) {
+	keys := testKeys()
+	want := append([]string(nil), keys...)
+	sort.Strings(want)
+
+	for seed := int64(0); seed < 5; seed++ {
+		t.Run(fmt.Sprintf("seed-%d", seed), func(t *testing.T) {
+			tree := testBuildTree(keys, seed)
+			it := tree.Root().Iterator()
+			require.Equal(t, want, testCollect(t, it.Next))
+
+			// Exhausted iterator stays exhausted
+			_, _, ok := it.Next()
+			require.False(t, ok)
+		})
+	}
+}
+
+func TestIteratorEmpty(t *testing.T) {
+	it := New().Root().Iterator()
+	_, _, ok := it.Next()
+	require.False(t, ok)
+
+	it.SeekPrefix([]byte("foo"))
+	_, _, ok = it.Next()
+	require.False(t, ok)
+}
+
+func TestIteratorSeekPrefix(t *testing.T) {
+	keys := testKeys()
+	sorted := append([]string(nil), keys...)
+	sort.Strings(sorted)
+
+	tree := testBuildTree(keys, 1)
+
+	prefixes := []string{
+		"",
+		"a",
+		"aa",
+		"aaaa",
+		"b",
+		"f",
+		"foo",
+		"foo/",
+		"foo/bar",
+		"foo/bar/baz/",
+		"mid/",
+		"wide/",
+		"wide/a",
+		"this/is/a/v",
+		"this/is/a/very/long/shared/prefix",
+		testLongPrefix,
+		testLongPrefix + "b",
+		testLongPrefix + "bb/and/then/another/long/b",
+		"this/is/a/very/long/shared/prefiX",
+		"zzz",
+	}
+
+	for _, p := range prefixes {
+		t.Run(p, func(t *testing.T) {
+			var want []string
+			for _, k := range sorted {
+				if strings.HasPrefix(k, p) {
+					want = append(want, k)
+				}
+			}
+			it := tree.Root().Iterator()
+			it.SeekPrefix([]byte(p))
+			require.Equal(t, want, testCollect(t, it.Next))
+		})
+	}
+}
+
+// testSeekKeys returns search keys around each of the keys in the tree: the key
+// itself, truncations, extensions and keys with the last byte moved either
+// way.
+func testSeekKeys(keys []string) []string {
+	seen := make(map[string]bool)
+	var out []string
+	add := func(k string) {
+		if !seen[k] {
+			seen[k] = true
+			out = append(out, k)
+		}
+	}
+	for _, k := range keys {
+		add(k)
+		add(k + "\x00")
+		add(k + "\xff")
+		if len(k) > 0 {
+			add(k[0 : len(k)-1])
+			add(k[0 : len(k)/2])
+			last := k[len(k)-1]
+			if last > 0 {
+				add(k[0:len(k)-1] + string([]byte{last - 1}))
+				add(k[0:len(k)-1] + string([]byte{last - 1}) + "\xff")
+			}
+			if last < 0xff {
+				add(k[0:len(k)-1] + string([]byte{last + 1}))
+			}
+		}
+	}
+	return out
+}
+
+func TestIteratorSeekLowerBound(t *testing.T) {
+	keys := testKeys()
+	sorted := append([]string(nil), keys...)
+	sort.Strings(sorted)
+
+	for seed := int64(0); seed < 3; seed++ {
+		tree := testBuildTree(keys, seed)
+
+		for _, s := range testSeekKeys(keys) {
+			idx := sort.SearchStrings(sorted, s)
+			want := sorted[idx:]
+			if len(want) == 0 {
+				want = nil
+			}
+
+			it := tree.Root().Iterator()
+			it.SeekLowerBound([]byte(s))
+			require.Equal(t, want, testCollect(t, it.Next), "seed %d seek %q", seed, s)
+		}
+	}
+}
@@ -6,6 +6,7 @@
 package art
 
 import (
+	"bytes"
 	"unsafe"
 )
 
@@ -19,15 +20,20 @@ const (
 	typNode256
 )
 
-type nodeHeader struct {
+type nodeHeader[V any] struct {
 	id  uint64
 	ref unsafe.Pointer
 	typ uint8
+
+	// replaced is set by WatchRegistry.notify, under its lock, once a commit
+	// has replaced this node in any tree that shares it. It fits in the padding
+	// after typ.
+	replaced bool
 }
 
-type innerNodeHeader struct {
-	nodeHeader
-	leaf *leafNode
+type innerNodeHeader[V any] struct {
+	nodeHeader[V]
+	leaf *leafNode[V]
 	// prefixLen stores the number of key bytes that are common among all
 	// children. It actually has to store O(k) since it might indicate a prefix
 	// much longer than the one we can store in maxPrefixLen. 65k is probably
@@ -41,15 +47,15 @@ type innerNodeHeader struct {
 	prefix    [maxPrefixLen]byte
 }
 
-type leafNode struct {
-	nodeHeader
+type leafNode[V any] struct {
+	nodeHeader[V]
 	key   []byte
-	value interface{}
+	value V
 }
 
 // copyInnerNodeHeader copies all the fields from one node header to another except
 // for ID and ref which are unique.
-func copyInnerNodeHeader(dst, src *innerNodeHeader) {
+func copyInnerNodeHeader[V any](dst, src *innerNodeHeader[V]) {
 	// Shallow copy is sufficient because prefix is an embedded array of byte
 	// not a slice pointing to a shared array, but we can't just use = since
 	// that would override the id and ref in nodeHeader
@@ -59,23 +65,23 @@ func copyInnerNodeHeader(dst, src *innerNodeHeader) {
 	dst.prefix = src.prefix
 }
 
-func (n *nodeHeader) node4() *node4 {
-	return (*node4)(n.ref)
+func (n *nodeHeader[V]) node4() *node4[V] {
+	return (*node4[V])(n.ref)
 }
-func (n *nodeHeader) node16() *node16 {
-	return (*node16)(n.ref)
+func (n *nodeHeader[V]) node16() *node16[V] {
+	return (*node16[V])(n.ref)
 }
-func (n *nodeHeader) node48() *node48 {
-	return (*node48)(n.ref)
+func (n *nodeHeader[V]) node48() *node48[V] {
+	return (*node48[V])(n.ref)
 }
-func (n *nodeHeader) node256() *node256 {
-	return (*node256)(n.ref)
+func (n *nodeHeader[V]) node256() *node256[V] {
+	return (*node256[V])(n.ref)
 }
-func (n *nodeHeader) leafNode() *leafNode {
-	return (*leafNode)(n.ref)
+func (n *nodeHeader[V]) leafNode() *leafNode[V] {
+	return (*leafNode[V])(n.ref)
 }
 
-func (n *nodeHeader) innerLeaf() *leafNode {
+func (n *nodeHeader[V]) innerLeaf() *leafNode[V] {
 	switch n.typ {
 	case typLeaf:
 		return nil
@@ -99,7 +105,7 @@ func (n *nodeHeader) innerLeaf() *leafNode {
 	panic("invalid type")
 }
 
-func (n *nodeHeader) setInnerLeaf(leaf *leafNode) {
+func (n *nodeHeader[V]) setInnerLeaf(leaf *leafNode[V]) {
 	switch n.typ {
 	case typNode4:
 		n4 := n.node4()
@@ -125,8 +131,10 @@ func (n *nodeHeader) setInnerLeaf(leaf *leafNode) {
 }
 
 // prefix returns the effective prefix of a node. If the prefix doesn't fit in
-// the prefix array then we find it from the leaf.
-func (n *nodeHeader) prefix() []byte {
+// the prefix array then we find it from the minimum leaf below the node. Since
+// nodes don't know their own depth, the caller must pass the number of key
+// bytes consumed before reaching this node.
+func (n *nodeHeader[V]) prefix(depth int) []byte {
 	pLen, pBytes := n.prefixFields()
 
 	if *pLen <= maxPrefixLen {
@@ -134,14 +142,30 @@ func (n *nodeHeader) prefix() []byte {
 		return pBytes[0:*pLen]
 	}
 
-	// Prefix is too long for node, we have to go find it from the leaf
-	minLeaf := n.minChild().leafNode()
-	return minLeaf.key[0:*pLen]
+	// Prefix is too long for node, we have to go find it from the leaf. Every
+	// leaf below this node shares the prefix so the minimum is as good as any.
+	minLeaf := n.minLeaf()
+	return minLeaf.key[depth : depth+int(*pLen)]
+}
+
+// minLeaf returns the leaf with the lowest key under n which may be n itself if
+// it is a leaf. Inner leaves sort before all children of the same node.
+func (n *nodeHeader[V]) minLeaf() *leafNode[V] {
+	for n != nil {
+		if n.typ == typLeaf {
+			return n.leafNode()
+		}
+		if leaf := n.innerLeaf(); leaf != nil {
+			return leaf
+		}
+		n = n.minChild()
+	}
+	return nil
 }
 
 // prefixFields returns pointers to the prefix len and byte slice if they exist
 // for convenience.
-func (n *nodeHeader) prefixFields() (*uint16, []byte) {
+func (n *nodeHeader[V]) prefixFields() (*uint16, []byte) {
 	switch n.typ {
 	case typLeaf:
 		// Leaves have no prefix
@@ -165,7 +189,7 @@ func (n *nodeHeader) prefixFields() (*uint16, []byte) {
 	panic("invalid type")
 }
 
-func (n *nodeHeader) findChild(c byte) *nodeHeader {
+func (n *nodeHeader[V]) findChild(c byte) *nodeHeader[V] {
 	switch n.typ {
 	case typLeaf:
 		// Leaves have no children
@@ -186,11 +210,201 @@ func (n *nodeHeader) findChild(c byte) *nodeHeader {
 	panic("invalid type")
 }
 
+// numChildren returns the number of children of an inner node or 0 for a
+// leaf.
+func (n *nodeHeader[V]) numChildren() int {
+	switch n.typ {
+	case typLeaf:
+		// Leaves have no children
+		return 0
+
+	case typNode4:
+		return int(n.node4().nChildren)
+
+	case typNode16:
+		return int(n.node16().nChildren)
+
+	case typNode48:
+		return int(n.node48().nChildren)
+
+	case typNode256:
+		return int(n.node256().nChildren)
+	}
+	panic("invalid type")
+}
+
+// childSlice returns the slice of child pointers of an inner node in no
+// particular order. For node256 it covers the whole array so may contain nil
+// entries which the caller must skip. The slice shares the node's array so
+// must not be modified.
+func (n *nodeHeader[V]) childSlice() []*nodeHeader[V] {
+	switch n.typ {
+	case typLeaf:
+		// Leaves have no children
+		return nil
+
+	case typNode4:
+		n4 := n.node4()
+		return n4.children[0:n4.nChildren]
+
+	case typNode16:
+		n16 := n.node16()
+		return n16.children[0:n16.nChildren]
+
+	case typNode48:
+		n48 := n.node48()
+		return n48.children[0:n48.nChildren]
+
+	case typNode256:
+		return n.node256().children[:]
+	}
+	panic("invalid type")
+}
+
+// maxLeaf returns the leaf with the highest key under n which may be n itself
+// if it is a leaf. Inner leaves sort before all children of the same node so
+// are only the maximum when there are no children.
+func (n *nodeHeader[V]) maxLeaf() *leafNode[V] {
+	for n != nil {
+		if n.typ == typLeaf {
+			return n.leafNode()
+		}
+		child := n.maxChild()
+		if child == nil {
+			return n.innerLeaf()
+		}
+		n = child
+	}
+	return nil
+}
+
+// findLeaf returns the leaf with key k in the subtree rooted at n or nil if
+// there is none.
+func (n *nodeHeader[V]) findLeaf(k []byte) *leafNode[V] {
+	_, leaf := n.search(k, 0)
+	return leaf
+}
+
+// findLeafAt is like findLeaf for a subtree n that is depth bytes below the
+// root.
+func (n *nodeHeader[V]) findLeafAt(k []byte, depth int) *leafNode[V] {
+	_, leaf := n.search(k, depth)
+	return leaf
+}
+
+// search looks for the leaf with key k in the subtree rooted at n, which is
+// depth bytes below the root. It returns the leaf if found. If not it also
+// returns the inner node that would have to change if k were inserted. That
+// may be nil if n is nil or a leaf.
+//
+// Only the prefix bytes actually stored in each node are compared. When a
+// prefix is longer than maxPrefixLen the remaining bytes are skipped
+// optimistically and the full key comparison at the leaf catches any mismatch.
+// In that case we can't tell which node k really diverged at so we return the
+// first node that was checked optimistically. Inserting k anywhere below it
+// would change it too.
+func (n *nodeHeader[V]) search(k []byte, depth int) (*nodeHeader[V], *leafNode[V]) {
+	var inner, optimistic *nodeHeader[V]
+	miss := func() (*nodeHeader[V], *leafNode[V]) {
+		if optimistic != nil {
+			return optimistic, nil
+		}
+		return inner, nil
+	}
+	for n != nil {
+		if n.typ == typLeaf {
+			leaf := n.leafNode()
+			if bytes.Equal(leaf.key, k) {
+				return nil, leaf
+			}
+			return miss()
+		}
+		inner = n
+
+		if !n.checkPrefix(k, depth) {
+			return miss()
+		}
+		pLen, _ := n.prefixFields()
+		if *pLen > maxPrefixLen && optimistic == nil {
+			optimistic = n
+		}
+		depth += int(*pLen)
+
+		if depth == len(k) {
+			// Key ends at this node so it can only be the inner leaf
+			if leaf := n.innerLeaf(); leaf != nil && bytes.Equal(leaf.key, k) {
+				return nil, leaf
+			}
+			return miss()
+		}
+
+		n = n.findChild(k[depth])
+		depth++
+	}
+	return miss()
+}
+
+// seekPrefix returns the highest node in the subtree rooted at n which has
+// only keys that start with prefix below it, or nil if there are no such keys.
+// The whole prefix of each node is compared since the caller will generally
+// use every key under the result without checking them again.
+func (n *nodeHeader[V]) seekPrefix(prefix []byte) *nodeHeader[V] {
+	match, _ := n.seekPrefixParent(prefix)
+	return match
+}
+
+// seekPrefixParent is like seekPrefix but also returns the deepest inner node
+// visited above the match. If there is no match that is the node where a key
+// with the prefix would be inserted.
+func (n *nodeHeader[V]) seekPrefixParent(prefix []byte) (*nodeHeader[V], *nodeHeader[V]) {
+	var parent *nodeHeader[V]
+	depth := 0
+	for n != nil {
+		if n.typ == typLeaf {
+			if bytes.HasPrefix(n.leafNode().key, prefix) {
+				return n, parent
+			}
+			return nil, parent
+		}
+
+		nodePrefix := n.prefix(depth)
+		remaining := prefix[depth:]
+		lcp := longestPrefix(remaining, nodePrefix)
+		if lcp == len(remaining) {
+			// Everything below this node starts with prefix.
+			return n, parent
+		}
+		if lcp < len(nodePrefix) {
+			// Mismatch so nothing under here matches
+			return nil, n
+		}
+		depth += len(nodePrefix)
+
+		parent = n
+		n = n.findChild(prefix[depth])
+		depth++
+	}
+	return nil, parent
+}
+
+// checkPrefix reports whether the stored prefix bytes of inner node n match k
+// starting at depth. If the prefix is longer than maxPrefixLen only the stored
+// bytes are compared so a true result is optimistic and must be confirmed
+// against a leaf key. A false result is always definitive.
+func (n *nodeHeader[V]) checkPrefix(k []byte, depth int) bool {
+	pLen, pBytes := n.prefixFields()
+	if depth+int(*pLen) > len(k) {
+		return false
+	}
+	stored := minU16(*pLen, maxPrefixLen)
+	return bytes.Equal(k[depth:depth+stored], pBytes[0:stored])
+}
+
 // addChild adds the child to the current node4 in place if possible or copies
 // itself into a node16 and returns that. We assume there is no existing child
 // with the same next byte. This MUST be ensured by the caller. Since the caller
 // always knows in practice it's cheaper not to check again here.
-func (n *nodeHeader) addChild(txn *Txn, c byte, child *nodeHeader) *nodeHeader {
+func (n *nodeHeader[V]) addChild(txn *Txn[V], c byte, child *nodeHeader[V]) *nodeHeader[V] {
 	switch n.typ {
 	case typLeaf:
 		// Leaves have no children
@@ -214,7 +428,7 @@ func (n *nodeHeader) addChild(txn *Txn, c byte, child *nodeHeader) *nodeHeader {
 // removeChild removes the child with given next byte. Other node types might
 // need to shrink and return a new node but node4 never can so always returns
 // itself.
-func (n *nodeHeader) removeChild(txn *Txn, c byte) *nodeHeader {
+func (n *nodeHeader[V]) removeChild(txn *Txn[V], c byte) *nodeHeader[V] {
 	switch n.typ {
 	case typLeaf:
 		// Leaves have no children
@@ -237,7 +451,7 @@ func (n *nodeHeader) removeChild(txn *Txn, c byte) *nodeHeader {
 
 // replaceChild replaces a child with a new node. It assumes the child is known
 // to exist and is a no-op if it doesn't.
-func (n *nodeHeader) replaceChild(txn *Txn, c byte, child *nodeHeader) *nodeHeader {
+func (n *nodeHeader[V]) replaceChild(txn *Txn[V], c byte, child *nodeHeader[V]) *nodeHeader[V] {
 	switch n.typ {
 	case typLeaf:
 		// Leaves have no children
@@ -260,7 +474,7 @@ func (n *nodeHeader) replaceChild(txn *Txn, c byte, child *nodeHeader) *nodeHead
 
 // minChild returns the child node with the lowest key or nil if there are no
 // children.
-func (n *nodeHeader) minChild() *nodeHeader {
+func (n *nodeHeader[V]) minChild() *nodeHeader[V] {
 	switch n.typ {
 	case typLeaf:
 		// Leaves have no children
@@ -283,7 +497,7 @@ func (n *nodeHeader) minChild() *nodeHeader {
 
 // maxChild returns the child node with the highest key or nil if there are no
 // children.
-func (n *nodeHeader) maxChild() *nodeHeader {
+func (n *nodeHeader[V]) maxChild() *nodeHeader[V] {
 	switch n.typ {
 	case typLeaf:
 		// Leaves have no children
@@ -304,14 +518,14 @@ func (n *nodeHeader) maxChild() *nodeHeader {
 	panic("invalid type")
 }
 
-// lowerBound returns the child node with the lowest key that is at least as
-// large as the search key or nil if there are no keys with a next-byte equal or
-// higher than c.
-func (n *nodeHeader) lowerBound(c byte) *nodeHeader {
+// lowerBound returns the child with the lowest next byte that is at least c
+// along with that byte. c is an int so that 256 can be passed to mean past the
+// last possible child. If there is no such child -1 and nil are returned.
+func (n *nodeHeader[V]) lowerBound(c int) (int, *nodeHeader[V]) {
 	switch n.typ {
 	case typLeaf:
 		// Leaves have no children
-		return nil
+		return -1, nil
 
 	case typNode4:
 		return n.node4().lowerBound(c)
@@ -328,9 +542,33 @@ func (n *nodeHeader) lowerBound(c byte) *nodeHeader {
 	panic("invalid type")
 }
 
+// upperBound returns the child with the highest next byte that is at most c
+// along with that byte. c is an int so that -1 can be passed to mean before the
+// first possible child. If there is no such child -1 and nil are returned.
+func (n *nodeHeader[V]) upperBound(c int) (int, *nodeHeader[V]) {
+	switch n.typ {
+	case typLeaf:
+		// Leaves have no children
+		return -1, nil
+
+	case typNode4:
+		return n.node4().upperBound(c)
+
+	case typNode16:
+		return n.node16().upperBound(c)
+
+	case typNode48:
+		return n.node48().upperBound(c)
+
+	case typNode256:
+		return n.node256().upperBound(c)
+	}
+	panic("invalid type")
+}
+
 // copy returns a new copy of the current node with the same contents but a new
 // ID.
-func (n *nodeHeader) copy(txn *Txn) *nodeHeader {
+func (n *nodeHeader[V]) copy(txn *Txn[V]) *nodeHeader[V] {
 	switch n.typ {
 	case typLeaf:
 		// Leaves have no children
@@ -352,18 +590,20 @@ func (n *nodeHeader) copy(txn *Txn) *nodeHeader {
 }
 
 // setPrefix assigned the prefix to the nodeHeader. If the p slice is longer
-// than maxPrefixLen then only the first maxPrefixLen bytes will be used.
-// Calling this on a non-leaf node will panic.
-func (n *nodeHeader) setPrefix(p []byte) {
+// than maxPrefixLen then only the first maxPrefixLen bytes will be stored but
+// the length is still recorded in full so that lookups know how many key bytes
+// to skip. Calling this on a leaf node will panic.
+func (n *nodeHeader[V]) setPrefix(p []byte) {
 	pLen, pBytes := n.prefixFields()
 
-	// Write to the byte array and set the length field to the num bytes copied
-	*pLen = uint16(copy(pBytes, p))
+	// Write to the byte array and set the length field to the full prefix length
+	copy(pBytes, p)
+	*pLen = uint16(len(p))
 }
 
 // leftTrimPrefix modifies n in-place by removing l bytes from the prefix.
 // Calling this on a non-leaf node will panic.
-func (n *nodeHeader) leftTrimPrefix(l uint16) {
+func (n *nodeHeader[V]) leftTrimPrefix(l uint16) {
 	if l < 1 {
 		return
 	}
@@ -382,7 +622,7 @@ func (n *nodeHeader) leftTrimPrefix(l uint16) {
 // slice should only represent the current size of the children of the node
 // although we assume the full child array is allocated underneath so the append
 // should never reallocate.
-func insertChild(children []*nodeHeader, child *nodeHeader, idx int) {
+func insertChild[V any](children []*nodeHeader[V], child *nodeHeader[V], idx int) {
 	// Append to "grow" the slice, should never reallocate so we don't need to
 	// return the slice to the caller since the underlying node array has been
 	// modified as desired.
@@ -403,7 +643,7 @@ func insertIndex(index []byte, c byte, idx int) {
 
 // removeChild removes an element from a child array and shuffles any later
 // pointers up one to keep it dense.
-func removeChild(children []*nodeHeader, idx int) {
+func removeChild[V any](children []*nodeHeader[V], idx int) {
 	copy(children[idx:], children[idx+1:])
 	children[len(children)-1] = nil
 }
@@ -8,15 +8,15 @@ import (
 // the index. The original paper and C versions optimise this further with SIMD
 // intrinsics to perform the comparison on all 16 bytes at once however
 // generating SIMD assembly for Go is non-trivial and left for a later time.
-type node16 struct {
-	innerNodeHeader
+type node16[V any] struct {
+	innerNodeHeader[V]
 	index    [16]byte
-	children [16]*nodeHeader
+	children [16]*nodeHeader[V]
 }
 
 // index returns the child index of the child with the next byte c. If there is
 // no such child, -1 is returned.
-func (n *node16) indexOf(c byte) int {
+func (n *node16[V]) indexOf(c byte) int {
 	idx := sort.Search(int(n.nChildren), func(i int) bool {
 		return n.index[i] >= c
 	})
@@ -27,7 +27,7 @@ func (n *node16) indexOf(c byte) int {
 }
 
 // findChild returns the child with the given next byte if any exists or nil.
-func (n *node16) findChild(c byte) *nodeHeader {
+func (n *node16[V]) findChild(c byte) *nodeHeader[V] {
 	if idx := n.indexOf(c); idx > -1 {
 		return n.children[idx]
 	}
@@ -38,7 +38,7 @@ func (n *node16) findChild(c byte) *nodeHeader {
 // itself into a node16 and returns that. We assume there is no existing child
 // with the same next byte. This MUST be ensured by the caller. Since the caller
 // always knows in practice it's cheaper not to check again here.
-func (n *node16) addChild(txn *Txn, c byte, child *nodeHeader) *nodeHeader {
+func (n *node16[V]) addChild(txn *Txn[V], c byte, child *nodeHeader[V]) *nodeHeader[V] {
 	if n.nChildren < 16 {
 		// Fast path, we have space so update in place
 		// Find the right place to insert
@@ -54,9 +54,9 @@ func (n *node16) addChild(txn *Txn, c byte, child *nodeHeader) *nodeHeader {
 	// Need to grow to a node48
 	n48 := txn.newNode48()
 
-	// Copy prefix
-	n48.prefixLen = n.prefixLen
-	copy(n48.prefix[0:maxPrefixLen], n.prefix[0:maxPrefixLen])
+	// Copy prefix and inner leaf
+	copyInnerNodeHeader(&n48.innerNodeHeader, &n.innerNodeHeader)
+	n48.nChildren = 0
 
 	// Copy children
 	for childIdx, childC := range n.index {
@@ -75,7 +75,7 @@ func (n *node16) addChild(txn *Txn, c byte, child *nodeHeader) *nodeHeader {
 
 // removeChild removes the child with given next byte. If the number of children
 // goes below 5 a node4 is returned instead.
-func (n *node16) removeChild(txn *Txn, c byte) *nodeHeader {
+func (n *node16[V]) removeChild(txn *Txn[V], c byte) *nodeHeader[V] {
 	idx := n.indexOf(c)
 	if idx < 0 {
 		// Child doesn't exist
@@ -93,9 +93,9 @@ func (n *node16) removeChild(txn *Txn, c byte) *nodeHeader {
 	// Convert to a node4
 	n4 := txn.newNode4()
 
-	// Copy prefix
-	n4.prefixLen = n.prefixLen
-	copy(n4.prefix[:], n.prefix[:])
+	// Copy prefix and inner leaf
+	copyInnerNodeHeader(&n4.innerNodeHeader, &n.innerNodeHeader)
+	n4.nChildren = 0
 
 	// Copy children
 	for childIdx, childC := range n.index[0:n.nChildren] {
@@ -112,7 +112,7 @@ func (n *node16) removeChild(txn *Txn, c byte) *nodeHeader {
 
 // replaceChild replaces a child with a new node. It assumes the child is known
 // to exist and is a no-op if it doesn't.
-func (n *node16) replaceChild(txn *Txn, c byte, child *nodeHeader) *nodeHeader {
+func (n *node16[V]) replaceChild(txn *Txn[V], c byte, child *nodeHeader[V]) *nodeHeader[V] {
 	idx := n.indexOf(c)
 	if idx < 0 {
 		// Child doesn't exist, don't do anything, this shouldn't really happen...
@@ -124,7 +124,7 @@ func (n *node16) replaceChild(txn *Txn, c byte, child *nodeHeader) *nodeHeader {
 
 // minChild returns the child node with the lowest key or nil if there are no
 // children.
-func (n *node16) minChild() *nodeHeader {
+func (n *node16[V]) minChild() *nodeHeader[V] {
 	if n.nChildren > 0 {
 		return n.children[0]
 	}
@@ -133,32 +133,43 @@ func (n *node16) minChild() *nodeHeader {
 
 // maxChild returns the child node with the highest key or nil if there are no
 // children.
-func (n *node16) maxChild() *nodeHeader {
+func (n *node16[V]) maxChild() *nodeHeader[V] {
 	if n.nChildren > 0 {
 		return n.children[n.nChildren-1]
 	}
 	return nil
 }
 
-// lowerBound returns the child node with the lowest key that is at least as
-// large as the search key or nil if there are no keys with a next-byte equal or
-// higher than c.
-func (n *node16) lowerBound(c byte) *nodeHeader {
-	if n.nChildren == 0 {
-		return nil
+// lowerBound returns the child with the lowest next byte that is at least c
+// along with that byte. c is an int so that 256 can be passed to mean past the
+// last possible child. If there is no such child -1 and nil are returned.
+func (n *node16[V]) lowerBound(c int) (int, *nodeHeader[V]) {
+	idx := sort.Search(int(n.nChildren), func(i int) bool {
+		return int(n.index[i]) >= c
+	})
+	if idx < int(n.nChildren) {
+		return int(n.index[idx]), n.children[idx]
 	}
-	for i := 0; i < int(n.nChildren); i++ {
-		if n.index[i] < c {
-			continue
-		}
-		return n.children[i]
+	return -1, nil
+}
+
+// upperBound returns the child with the highest next byte that is at most c
+// along with that byte. c is an int so that -1 can be passed to mean before the
+// first possible child. If there is no such child -1 and nil are returned.
+func (n *node16[V]) upperBound(c int) (int, *nodeHeader[V]) {
+	// Find the first index higher than c, the one before it is the one we want.
+	idx := sort.Search(int(n.nChildren), func(i int) bool {
+		return int(n.index[i]) > c
+	}) - 1
+	if idx >= 0 {
+		return int(n.index[idx]), n.children[idx]
 	}
-	return nil
+	return -1, nil
 }
 
 // copy returns a new copy of the current node with the same contents but a new
 // ID.
-func (n *node16) copy(txn *Txn) *nodeHeader {
+func (n *node16[V]) copy(txn *Txn[V]) *nodeHeader[V] {
 	nn := txn.newNode16()
 	copyInnerNodeHeader(&nn.innerNodeHeader, &n.innerNodeHeader)
 	// Copy index and children
@@ -14,8 +14,8 @@ import (
 // for all node sizes.
 var allTheBytes = []byte{'Z', 'a', 0x0, 0xff, '1', '-', '}', '_', '#', '~', ')', 0x81, 0xe5, '0', 0x6, '^', 'E', 0x14, 0xc2, 0xec, 'O', 0x9c, 'C', 'd', 0xef, 0x98, 0x95, ']', '[', '8', 0x8, 0xb7, '*', 0x94, 'r', ';', '9', 0x5, 'p', 0x97, '6', 0x4, 'm', 0x91, 0xe4, 0xc4, 0xfa, 'h', 0xa9, 'k', 'V', '@', 'b', 0xb5, 0xc8, ':', 0xc7, 'F', 0x8a, 0xb3, '<', 0xf9, '"', '{', 0x1e, 0x16, '|', 0xf0, 0xc9, 0x84, 0xda, 0x15, 'J', 'S', '\'', 0xdf, 'I', 'X', 0x88, 0x1b, 0x85, 0xa, 'Y', '3', 0xd7, 0xfb, 'l', 0x3, 0xeb, 0xf1, 0x13, 'f', 'G', '&', 0xa6, 0xdc, 'n', 0x17, 0xe8, 0x19, 0xac, 0xd2, 0x8e, 0xd3, 'y', 0xf2, 'K', 0xd0, 0xc3, 0xcb, 0xe2, 0xfd, 0xb0, 0x11, 'B', 0x9e, 0xe7, 0xed, 'c', 0xfe, 0xad, 0xdd, 'u', 0x8b, 0xd5, 0x82, 'U', 0xb2, 0xbb, 'T', '\\', ',', 0xa4, 0xf7, 'z', ' ', 0x7f, 0xb1, 0xaa, 0x9b, 'o', 0xb9, 0xab, '=', 'L', 0xb8, 0xea, 0xc0, 0x10, 'j', 0xa0, 0xcc, 0x99, 0xa1, 0xba, 0x83, 0x1c, 0x89, '%', 0xd8, 0xf8, '7', 'H', '2', 0x1a, '.', '5', 0xe0, 0x7, 0xd9, 0xbd, 'x', 0xdb, 0xa7, 'w', 0xb, 0xfc, 'A', 0x87, '`', 0xde, 'D', 0x90, 0xd6, 0xe3, 'e', 0xcf, 'g', 0xd4, 0xaf, 0x9d, 0x8d, 0xa8, 'R', 0xa3, '/', '4', 0xf, 'q', 0xe6, 0xf5, 't', '+', 'P', 0xf6, '!', 0xc6, 0xc5, 0x92, 0xc1, 0xd, 0x1f, 0x18, 0x8f, 0xc, 0x12, 'v', 0xe, '>', 0x9a, 'N', 'Q', 0x86, 0xa2, 'i', '?', 0xf4, 'M', 0xbe, 0xd1, 0x96, 0xe9, 0x9f, 0xca, 0xbf, '(', 'W', 0xb4, 0xbc, '$', 0xee, 0x9, 0x8c, 0x80, 0x93, 0xae, 0x1, 0x2, 0xb6, 0xf3, 0x1d, 's', 0xcd, 0xe1, 0xa5, 0xce}
 
-func testMakeChildLeaves(t *testing.T, txn *Txn, n int) []*nodeHeader {
-	children := make([]*nodeHeader, n)
+func testMakeChildLeaves(t *testing.T, txn *Txn[any], n int) []*nodeHeader[any] {
+	children := make([]*nodeHeader[any], n)
 	for i := range children {
 		c := allTheBytes[i]
 		k := string([]byte{c, c, c})
@@ -33,26 +33,26 @@ func testSortBytes(bs []byte) []byte {
 	return sorted
 }
 
-func testSortChildren(children []*nodeHeader) {
+func testSortChildren(children []*nodeHeader[any]) {
 	sort.Slice(children, func(i, j int) bool {
 		return bytes.Compare(children[i].leafNode().key, children[j].leafNode().key) < 0
 	})
 }
 
 func TestNode16FindChild(t *testing.T) {
-	txn := &Txn{}
+	txn := &Txn[any]{}
 
 	tests := []struct {
 		name     string
 		index    []byte
-		children []*nodeHeader
+		children []*nodeHeader[any]
 		c        byte
 		wantKey  string
 	}{
 		{
 			name:     "empty",
 			index:    []byte{},
-			children: []*nodeHeader{},
+			children: []*nodeHeader[any]{},
 			c:        'a',
 			wantKey:  "",
 		},
@@ -108,9 +108,9 @@ func TestNode16FindChild(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			n := &node16{
-				innerNodeHeader: innerNodeHeader{
-					nodeHeader: nodeHeader{
+			n := &node16[any]{
+				innerNodeHeader: innerNodeHeader[any]{
+					nodeHeader: nodeHeader[any]{
 						id:  1,
 						typ: typNode16,
 					},
@@ -129,7 +129,7 @@ func TestNode16FindChild(t *testing.T) {
 }
 
 func TestNode16AddRemoveChild(t *testing.T) {
-	txn := &Txn{}
+	txn := &Txn[any]{}
 	require := require.New(t)
 
 	// Start with an empty node16
@@ -138,7 +138,7 @@ func TestNode16AddRemoveChild(t *testing.T) {
 	require.Equal(0, int(n.nChildren))
 	require.Equal(typNode16, n.typ)
 
-	var n16h *nodeHeader
+	var n16h *nodeHeader[any]
 
 	children := testMakeChildLeaves(t, txn, 17)
 
@@ -199,17 +199,46 @@ func TestNode16AddRemoveChild(t *testing.T) {
 	}
 }
 
+func TestNode16Grow(t *testing.T) {
+	txn := &Txn[any]{}
+	require := require.New(t)
+
+	// A full node16 with a prefix and an inner leaf
+	nh := &txn.newNode16().nodeHeader
+	nh.setPrefix([]byte("foo"))
+	nh.setInnerLeaf(testMakeLeaf(txn, "foo").leafNode())
+	children := testMakeChildLeaves(t, txn, 17)
+	for i, child := range children[0:16] {
+		nh = nh.addChild(txn, allTheBytes[i], child)
+	}
+	require.Equal(typNode16, nh.typ)
+
+	// Add child 17
+	nh = nh.addChild(txn, allTheBytes[16], children[16])
+	// Should grow to a node48 with all the children
+	require.Equal(typNode48, nh.typ)
+	require.Equal(17, int(nh.node48().nChildren))
+	for j, wantChild := range children {
+		assertChildHasLeaf(t, nh, allTheBytes[j], string(wantChild.leafNode().key))
+	}
+	// The prefix and inner leaf should have been kept
+	pLen, pBytes := nh.prefixFields()
+	require.Equal("foo", string(pBytes[0:*pLen]))
+	require.NotNil(nh.innerLeaf())
+	require.Equal("foo", string(nh.innerLeaf().key))
+}
+
 func TestNode16MinMaxChild(t *testing.T) {
-	txn := &Txn{}
+	txn := &Txn[any]{}
 
 	tests := []struct {
 		name             string
-		children         []*nodeHeader
+		children         []*nodeHeader[any]
 		wantMin, wantMax string
 	}{
 		{
 			name:     "empty",
-			children: []*nodeHeader{},
+			children: []*nodeHeader[any]{},
 			wantMin:  "",
 			wantMax:  "",
 		},
@@ -221,19 +250,19 @@ func TestNode16MinMaxChild(t *testing.T) {
 		},
 		{
 			name:     "one null",
-			children: []*nodeHeader{testMakeLeaf(txn, "\x00\x00\x00")},
+			children: []*nodeHeader[any]{testMakeLeaf(txn, "\x00\x00\x00")},
 			wantMin:  "\x00\x00\x00",
 			wantMax:  "\x00\x00\x00",
 		},
 		{
 			name:     "one str",
-			children: []*nodeHeader{testMakeLeaf(txn, "foo")},
+			children: []*nodeHeader[any]{testMakeLeaf(txn, "foo")},
 			wantMin:  "foo",
 			wantMax:  "foo",
 		},
 		{
 			name: "two str",
-			children: []*nodeHeader{
+			children: []*nodeHeader[any]{
 				testMakeLeaf(txn, "foo"),
 				testMakeLeaf(txn, "aaa"),
 			},
@@ -258,17 +287,17 @@ func TestNode16MinMaxChild(t *testing.T) {
 }
 
 func TestNode16LowerBound(t *testing.T) {
-	txn := &Txn{}
+	txn := &Txn[any]{}
 
 	tests := []struct {
 		name      string
-		children  []*nodeHeader
+		children  []*nodeHeader[any]
 		key       string
 		wantLower string
 	}{
 		{
 			name:      "empty",
-			children:  []*nodeHeader{},
+			children:  []*nodeHeader[any]{},
 			key:       "foo",
 			wantLower: "",
 		},
@@ -299,8 +328,66 @@ func TestNode16LowerBound(t *testing.T) {
 				n = n.addChild(txn, child.leafNode().key[0], child)
 			}
 
-			gotLower := n.lowerBound(tt.key[0])
+			edge, gotLower := n.lowerBound(int(tt.key[0]))
 			assertLeafKey(t, gotLower, tt.wantLower)
+			if tt.wantLower == "" {
+				require.Equal(t, -1, edge)
+			} else {
+				require.Equal(t, int(tt.wantLower[0]), edge)
+			}
+		})
+	}
+}
+
+func TestNode16UpperBound(t *testing.T) {
+	txn := &Txn[any]{}
+
+	tests := []struct {
+		name      string
+		children  []*nodeHeader[any]
+		key       string
+		wantUpper string
+	}{
+		{
+			name:      "empty",
+			children:  []*nodeHeader[any]{},
+			key:       "foo",
+			wantUpper: "",
+		},
+		{
+			name:      "full, match",
+			children:  testMakeChildLeaves(t, txn, 16),
+			key:       "aaa",
+			wantUpper: "aaa",
+		},
+		{
+			name:      "full, no match",
+			children:  testMakeChildLeaves(t, txn, 16),
+			key:       "bbb",
+			wantUpper: "aaa",
+		},
+		{
+			name:      "full, last",
+			children:  testMakeChildLeaves(t, txn, 16),
+			key:       "\xff",
+			wantUpper: "\xff\xff\xff",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			n := &txn.newNode16().nodeHeader
+			for _, child := range tt.children {
+				n = n.addChild(txn, child.leafNode().key[0], child)
+			}
+
+			edge, gotUpper := n.upperBound(int(tt.key[0]))
+			assertLeafKey(t, gotUpper, tt.wantUpper)
+			if tt.wantUpper == "" {
+				require.Equal(t, -1, edge)
+			} else {
+				require.Equal(t, int(tt.wantUpper[0]), edge)
+			}
 		})
 	}
 }
@@ -2,24 +2,24 @@ package art
 
 // node256 is a radix node with >48 children. It has a full 256 byte pointer
 // array so lookup is constant time.
-type node256 struct {
-	innerNodeHeader
-	children [256]*nodeHeader
+type node256[V any] struct {
+	innerNodeHeader[V]
+	children [256]*nodeHeader[V]
 }
 
 // index returns the child index of the child with the next byte c. If there is
 // no such child, -1 is returned.
-func (n *node256) indexOf(c byte) int {
+func (n *node256[V]) indexOf(c byte) int {
 	return int(c)
 }
 
 // findChild returns the child with the given next byte if any exists or nil.
-func (n *node256) findChild(c byte) *nodeHeader {
+func (n *node256[V]) findChild(c byte) *nodeHeader[V] {
 	return n.children[c]
 }
 
 // addChild adds the child to the current node256 in place.
-func (n *node256) addChild(txn *Txn, c byte, child *nodeHeader) *nodeHeader {
+func (n *node256[V]) addChild(txn *Txn[V], c byte, child *nodeHeader[V]) *nodeHeader[V] {
 	n.children[c] = child
 	n.nChildren++
 	return &n.nodeHeader
@@ -27,14 +27,14 @@ func (n *node256) addChild(txn *Txn, c byte, child *nodeHeader) *nodeHeader {
 
 // removeChild removes the child with given next byte. If the number of children
 // goes below 49 a node48 is returned instead.
-func (n *node256) removeChild(txn *Txn, c byte) *nodeHeader {
+func (n *node256[V]) removeChild(txn *Txn[V], c byte) *nodeHeader[V] {
 	idx := n.indexOf(c)
 	if idx < 0 {
 		// Child doesn't exist
 		return &n.nodeHeader
 	}
 
-	if n.nChildren > 48 {
+	if n.nChildren > (48 + 1) {
 		// Remove in place.
 		n.children[c] = nil
 		n.nChildren--
@@ -44,9 +44,9 @@ func (n *node256) removeChild(txn *Txn, c byte) *nodeHeader {
 	// Convert to a node48
 	n48 := txn.newNode48()
 
-	// Copy prefix
-	n48.prefixLen = n.prefixLen
-	copy(n48.prefix[:], n.prefix[:])
+	// Copy prefix and inner leaf
+	copyInnerNodeHeader(&n48.innerNodeHeader, &n.innerNodeHeader)
+	n48.nChildren = 0
 
 	// Copy children
 	for childC, child := range n.children {
@@ -62,14 +62,14 @@ func (n *node256) removeChild(txn *Txn, c byte) *nodeHeader {
 
 // replaceChild replaces a child with a new node. It assumes the child is known
 // to exist and is a no-op if it doesn't.
-func (n *node256) replaceChild(txn *Txn, c byte, child *nodeHeader) *nodeHeader {
+func (n *node256[V]) replaceChild(txn *Txn[V], c byte, child *nodeHeader[V]) *nodeHeader[V] {
 	n.children[c] = child
 	return &n.nodeHeader
 }
 
 // minChild returns the child node with the lowest key or nil if there are no
 // children.
-func (n *node256) minChild() *nodeHeader {
+func (n *node256[V]) minChild() *nodeHeader[V] {
 	// Find first byte index at which a child exists
 	for i := 0; i <= 255; i++ {
 		if n.children[i] != nil {
@@ -81,7 +81,7 @@ func (n *node256) minChild() *nodeHeader {
 
 // maxChild returns the child node with the highest key or nil if there are no
 // children.
-func (n *node256) maxChild() *nodeHeader {
+func (n *node256[V]) maxChild() *nodeHeader[V] {
 	// Find last byte index at which a child exists
 	for i := 255; i >= 0; i-- {
 		if n.children[i] != nil {
@@ -91,19 +91,33 @@ func (n *node256) maxChild() *nodeHeader {
 	return nil
 }
 
-// lowerBound returns the child node with the lowest key that is at least as
-// large as the search key or nil if there are no keys with a next-byte equal or
-// higher than c.
-func (n *node256) lowerBound(c byte) *nodeHeader {
-	if n.nChildren == 0 {
-		return nil
+// lowerBound returns the child with the lowest next byte that is at least c
+// along with that byte. c is an int so that 256 can be passed to mean past the
+// last possible child. If there is no such child -1 and nil are returned.
+func (n *node256[V]) lowerBound(c int) (int, *nodeHeader[V]) {
+	for i := c; i < 256; i++ {
+		if n.children[i] != nil {
+			return i, n.children[i]
+		}
 	}
-	return nil
+	return -1, nil
+}
+
+// upperBound returns the child with the highest next byte that is at most c
+// along with that byte. c is an int so that -1 can be passed to mean before the
+// first possible child. If there is no such child -1 and nil are returned.
+func (n *node256[V]) upperBound(c int) (int, *nodeHeader[V]) {
+	for i := min(c, 255); i >= 0; i-- {
+		if n.children[i] != nil {
+			return i, n.children[i]
+		}
+	}
+	return -1, nil
 }
 
 // copy returns a new copy of the current node with the same contents but a new
 // ID.
-func (n *node256) copy(txn *Txn) *nodeHeader {
+func (n *node256[V]) copy(txn *Txn[V]) *nodeHeader[V] {
 	nn := txn.newNode256()
 	copyInnerNodeHeader(&nn.innerNodeHeader, &n.innerNodeHeader)
 	// Copy index and children
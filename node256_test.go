@@ -7,8 +7,8 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
-func testMakeNode256ChildLeaves(t *testing.T, txn *Txn, n int) []*nodeHeader {
-	children := make([]*nodeHeader, 256)
+func testMakeNode256ChildLeaves(t *testing.T, txn *Txn[any], n int) []*nodeHeader[any] {
+	children := make([]*nodeHeader[any], 256)
 	for i := range children {
 		if i == n {
 			break
@@ -21,19 +21,19 @@ func testMakeNode256ChildLeaves(t *testing.T, txn *Txn, n int) []*nodeHeader {
 }
 
 func TestNode256FindChild(t *testing.T) {
-	txn := &Txn{}
+	txn := &Txn[any]{}
 
 	tests := []struct {
 		name     string
 		index    []byte
-		children []*nodeHeader
+		children []*nodeHeader[any]
 		c        byte
 		wantKey  string
 	}{
 		{
 			name:     "empty",
 			index:    []byte{},
-			children: []*nodeHeader{},
+			children: []*nodeHeader[any]{},
 			c:        'a',
 			wantKey:  "",
 		},
@@ -82,9 +82,9 @@ func TestNode256FindChild(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			n := &node256{
-				innerNodeHeader: innerNodeHeader{
-					nodeHeader: nodeHeader{
+			n := &node256[any]{
+				innerNodeHeader: innerNodeHeader[any]{
+					nodeHeader: nodeHeader[any]{
 						id:  1,
 						typ: typNode256,
 					},
@@ -101,7 +101,7 @@ func TestNode256FindChild(t *testing.T) {
 }
 
 func TestNode256AddRemoveChild(t *testing.T) {
-	txn := &Txn{}
+	txn := &Txn[any]{}
 	require := require.New(t)
 
 	// Start with an empty node256
@@ -110,7 +110,7 @@ func TestNode256AddRemoveChild(t *testing.T) {
 	require.Equal(0, int(n.nChildren))
 	require.Equal(typNode256, n.typ)
 
-	var n256h *nodeHeader
+	var n256h *nodeHeader[any]
 
 	children := testMakeChildLeaves(t, txn, 256)
 
@@ -162,16 +162,16 @@ func TestNode256AddRemoveChild(t *testing.T) {
 }
 
 func TestNode256MinMaxChild(t *testing.T) {
-	txn := &Txn{}
+	txn := &Txn[any]{}
 
 	tests := []struct {
 		name             string
-		children         []*nodeHeader
+		children         []*nodeHeader[any]
 		wantMin, wantMax string
 	}{
 		{
 			name:     "empty",
-			children: []*nodeHeader{},
+			children: []*nodeHeader[any]{},
 			wantMin:  "",
 			wantMax:  "",
 		},
@@ -183,19 +183,19 @@ func TestNode256MinMaxChild(t *testing.T) {
 		},
 		{
 			name:     "one null",
-			children: []*nodeHeader{testMakeLeaf(txn, "\x00\x00\x00")},
+			children: []*nodeHeader[any]{testMakeLeaf(txn, "\x00\x00\x00")},
 			wantMin:  "\x00\x00\x00",
 			wantMax:  "\x00\x00\x00",
 		},
 		{
 			name:     "one str",
-			children: []*nodeHeader{testMakeLeaf(txn, "foo")},
+			children: []*nodeHeader[any]{testMakeLeaf(txn, "foo")},
 			wantMin:  "foo",
 			wantMax:  "foo",
 		},
 		{
 			name: "two str",
-			children: []*nodeHeader{
+			children: []*nodeHeader[any]{
 				testMakeLeaf(txn, "foo"),
 				testMakeLeaf(txn, "aaa"),
 			},
@@ -220,17 +220,17 @@ func TestNode256MinMaxChild(t *testing.T) {
 }
 
 func TestNode256LowerBound(t *testing.T) {
-	txn := &Txn{}
+	txn := &Txn[any]{}
 
 	tests := []struct {
 		name      string
-		children  []*nodeHeader
+		children  []*nodeHeader[any]
 		key       string
 		wantLower string
 	}{
 		{
 			name:      "empty",
-			children:  []*nodeHeader{},
+			children:  []*nodeHeader[any]{},
 			key:       "foo",
 			wantLower: "",
 		},
@@ -261,8 +261,66 @@ func TestNode256LowerBound(t *testing.T) {
 				n = n.addChild(txn, child.leafNode().key[0], child)
 			}
 
-			gotLower := n.lowerBound(tt.key[0])
+			edge, gotLower := n.lowerBound(int(tt.key[0]))
 			assertLeafKey(t, gotLower, tt.wantLower)
+			if tt.wantLower == "" {
+				require.Equal(t, -1, edge)
+			} else {
+				require.Equal(t, int(tt.wantLower[0]), edge)
+			}
+		})
+	}
+}
+
+func TestNode256UpperBound(t *testing.T) {
+	txn := &Txn[any]{}
+
+	tests := []struct {
+		name      string
+		children  []*nodeHeader[any]
+		key       string
+		wantUpper string
+	}{
+		{
+			name:      "empty",
+			children:  []*nodeHeader[any]{},
+			key:       "foo",
+			wantUpper: "",
+		},
+		{
+			name:      "full, match",
+			children:  testMakeChildLeaves(t, txn, 48),
+			key:       "aaa",
+			wantUpper: "aaa",
+		},
+		{
+			name:      "full, no match",
+			children:  testMakeChildLeaves(t, txn, 48),
+			key:       "bbb",
+			wantUpper: "aaa",
+		},
+		{
+			name:      "full, last",
+			children:  testMakeChildLeaves(t, txn, 48),
+			key:       "\xff",
+			wantUpper: "\xff\xff\xff",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			n := &txn.newNode256().nodeHeader
+			for _, child := range tt.children {
+				n = n.addChild(txn, child.leafNode().key[0], child)
+			}
+
+			edge, gotUpper := n.upperBound(int(tt.key[0]))
+			assertLeafKey(t, gotUpper, tt.wantUpper)
+			if tt.wantUpper == "" {
+				require.Equal(t, -1, edge)
+			} else {
+				require.Equal(t, int(tt.wantUpper[0]), edge)
+			}
 		})
 	}
 }
@@ -3,15 +3,15 @@ package art
 // node4 is a radix node with 0-4 children. It's so small the index doesn't need
 // to be sorted for search - we just iterate. We actually do keep it sorted just
 // because that makes growing into a node16 simpler and costs very little.
-type node4 struct {
-	innerNodeHeader
+type node4[V any] struct {
+	innerNodeHeader[V]
 	index    [4]byte
-	children [4]*nodeHeader
+	children [4]*nodeHeader[V]
 }
 
 // index returns the child index of the child with the next byte c. If there is
 // no such child, -1 is returned.
-func (n *node4) indexOf(c byte) int {
+func (n *node4[V]) indexOf(c byte) int {
 	for i := 0; i < int(n.nChildren); i++ {
 		if n.index[i] == c {
 			return i
@@ -21,7 +21,7 @@ func (n *node4) indexOf(c byte) int {
 }
 
 // findChild returns the child with the given next byte if any exists or nil.
-func (n *node4) findChild(c byte) *nodeHeader {
+func (n *node4[V]) findChild(c byte) *nodeHeader[V] {
 	if idx := n.indexOf(c); idx > -1 {
 		return n.children[idx]
 	}
@@ -32,7 +32,7 @@ func (n *node4) findChild(c byte) *nodeHeader {
 // itself into a node16 and returns that. We assume there is no existing child
 // with the same next byte. This MUST be ensured by the caller. Since the caller
 // always knows in practice it's cheaper not to check again here.
-func (n *node4) addChild(txn *Txn, c byte, child *nodeHeader) *nodeHeader {
+func (n *node4[V]) addChild(txn *Txn[V], c byte, child *nodeHeader[V]) *nodeHeader[V] {
 	if n.nChildren < 4 {
 		// Fast path, we have space so update in place
 		// Find the right place to insert
@@ -73,6 +73,12 @@ func (n *node4) addChild(txn *Txn, c byte, child *nodeHeader) *nodeHeader {
 		n16.children[n16Idx] = n.children[childIdx]
 		n16Idx++
 	}
+	if !inserted {
+		// New child sorts after all the existing ones
+		n16.index[n16Idx] = c
+		n16.children[n16Idx] = child
+		n16Idx++
+	}
 	n16.nChildren = uint16(n16Idx)
 
 	return &n16.nodeHeader
@@ -81,7 +87,7 @@ func (n *node4) addChild(txn *Txn, c byte, child *nodeHeader) *nodeHeader {
 // removeChild removes the child with given next byte. Other node types might
 // need to shrink and return a new node but node4 never can so always returns
 // itself.
-func (n *node4) removeChild(txn *Txn, c byte) *nodeHeader {
+func (n *node4[V]) removeChild(txn *Txn[V], c byte) *nodeHeader[V] {
 	idx := n.indexOf(c)
 	if idx < 0 {
 		// Child doesn't exist
@@ -98,7 +104,7 @@ func (n *node4) removeChild(txn *Txn, c byte) *nodeHeader {
 
 // replaceChild replaces a child with a new node. It assumes the child is known
 // to exist and is a no-op if it doesn't.
-func (n *node4) replaceChild(txn *Txn, c byte, child *nodeHeader) *nodeHeader {
+func (n *node4[V]) replaceChild(txn *Txn[V], c byte, child *nodeHeader[V]) *nodeHeader[V] {
 	idx := n.indexOf(c)
 	if idx < 0 {
 		// Child doesn't exist, don't do anything, this shouldn't really happen...
@@ -110,7 +116,7 @@ func (n *node4) replaceChild(txn *Txn, c byte, child *nodeHeader) *nodeHeader {
 
 // minChild returns the child node with the lowest key or nil if there are no
 // children.
-func (n *node4) minChild() *nodeHeader {
+func (n *node4[V]) minChild() *nodeHeader[V] {
 	if n.nChildren > 0 {
 		return n.children[0]
 	}
@@ -119,32 +125,40 @@ func (n *node4) minChild() *nodeHeader {
 
 // maxChild returns the child node with the highest key or nil if there are no
 // children.
-func (n *node4) maxChild() *nodeHeader {
+func (n *node4[V]) maxChild() *nodeHeader[V] {
 	if n.nChildren > 0 {
 		return n.children[n.nChildren-1]
 	}
 	return nil
 }
 
-// lowerBound returns the child node with the lowest key that is at least as
-// large as the search key or nil if there are no keys with a next-byte equal or
-// higher than c.
-func (n *node4) lowerBound(c byte) *nodeHeader {
-	if n.nChildren == 0 {
-		return nil
-	}
+// lowerBound returns the child with the lowest next byte that is at least c
+// along with that byte. c is an int so that 256 can be passed to mean past the
+// last possible child. If there is no such child -1 and nil are returned.
+func (n *node4[V]) lowerBound(c int) (int, *nodeHeader[V]) {
 	for i := 0; i < int(n.nChildren); i++ {
-		if n.index[i] < c {
-			continue
+		if int(n.index[i]) >= c {
+			return int(n.index[i]), n.children[i]
 		}
-		return n.children[i]
 	}
-	return nil
+	return -1, nil
+}
+
+// upperBound returns the child with the highest next byte that is at most c
+// along with that byte. c is an int so that -1 can be passed to mean before the
+// first possible child. If there is no such child -1 and nil are returned.
+func (n *node4[V]) upperBound(c int) (int, *nodeHeader[V]) {
+	for i := int(n.nChildren) - 1; i >= 0; i-- {
+		if int(n.index[i]) <= c {
+			return int(n.index[i]), n.children[i]
+		}
+	}
+	return -1, nil
 }
 
 // copy returns a new copy of the current node with the same contents but a new
 // ID.
-func (n *node4) copy(txn *Txn) *nodeHeader {
+func (n *node4[V]) copy(txn *Txn[V]) *nodeHeader[V] {
 	nn := txn.newNode4()
 	copyInnerNodeHeader(&nn.innerNodeHeader, &n.innerNodeHeader)
 	// Copy index and children
@@ -4,20 +4,20 @@ package art
 // lookup is constant time. As in the original paper we use the full 8 bits for
 // each entry for lookup speed over saving the extra 2 bytes per entry since
 // only 48 indexes are needed.
-type node48 struct {
-	innerNodeHeader
+type node48[V any] struct {
+	innerNodeHeader[V]
 	index    [256]byte
-	children [48]*nodeHeader
+	children [48]*nodeHeader[V]
 }
 
 // index returns the child index of the child with the next byte c. If there is
 // no such child, -1 is returned.
-func (n *node48) indexOf(c byte) int {
+func (n *node48[V]) indexOf(c byte) int {
 	return int(n.index[c]) - 1
 }
 
 // findChild returns the child with the given next byte if any exists or nil.
-func (n *node48) findChild(c byte) *nodeHeader {
+func (n *node48[V]) findChild(c byte) *nodeHeader[V] {
 	if idx := n.indexOf(c); idx > -1 {
 		return n.children[idx]
 	}
@@ -28,7 +28,7 @@ func (n *node48) findChild(c byte) *nodeHeader {
 // itself into a node48 and returns that. We assume there is no existing child
 // with the same next byte. This MUST be ensured by the caller. Since the caller
 // always knows in practice it's cheaper not to check again here.
-func (n *node48) addChild(txn *Txn, c byte, child *nodeHeader) *nodeHeader {
+func (n *node48[V]) addChild(txn *Txn[V], c byte, child *nodeHeader[V]) *nodeHeader[V] {
 	if n.nChildren < 48 {
 		// Fast path, we have space so update in place. No need to keep children
 		// sorted since the index stores the offset in O(1) lookup.
@@ -42,9 +42,9 @@ func (n *node48) addChild(txn *Txn, c byte, child *nodeHeader) *nodeHeader {
 	// Need to grow to a node256
 	n256 := txn.newNode256()
 
-	// Copy prefix
-	n256.prefixLen = n.prefixLen
-	copy(n256.prefix[:], n.prefix[:])
+	// Copy prefix and inner leaf
+	copyInnerNodeHeader(&n256.innerNodeHeader, &n.innerNodeHeader)
+	n256.nChildren = 0
 
 	// Copy children
 	for childC, offset := range n.index {
@@ -62,7 +62,7 @@ func (n *node48) addChild(txn *Txn, c byte, child *nodeHeader) *nodeHeader {
 
 // removeChild removes the child with given next byte. If the number of children
 // goes below 17 a node16 is returned instead.
-func (n *node48) removeChild(txn *Txn, c byte) *nodeHeader {
+func (n *node48[V]) removeChild(txn *Txn[V], c byte) *nodeHeader[V] {
 	idx := n.indexOf(c)
 	if idx < 0 {
 		// Child doesn't exist
@@ -90,14 +90,16 @@ func (n *node48) removeChild(txn *Txn, c byte) *nodeHeader {
 	// Convert to a node16
 	n16 := txn.newNode16()
 
-	// Copy prefix
-	n16.prefixLen = n.prefixLen
-	copy(n16.prefix[:], n.prefix[:])
+	// Copy prefix and inner leaf
+	copyInnerNodeHeader(&n16.innerNodeHeader, &n.innerNodeHeader)
+	n16.nChildren = 0
 
-	// Copy children
+	// Copy children. Iterating the index in byte order keeps the node16 index
+	// sorted.
 	for childC, offset := range n.index {
 		if offset > 0 && byte(childC) != c {
-			n16.children[childC] = n.children[offset-1]
+			n16.index[n16.nChildren] = byte(childC)
+			n16.children[n16.nChildren] = n.children[offset-1]
 			n16.nChildren++
 		}
 	}
@@ -107,7 +109,7 @@ func (n *node48) removeChild(txn *Txn, c byte) *nodeHeader {
 
 // replaceChild replaces a child with a new node. It assumes the child is known
 // to exist and is a no-op if it doesn't.
-func (n *node48) replaceChild(txn *Txn, c byte, child *nodeHeader) *nodeHeader {
+func (n *node48[V]) replaceChild(txn *Txn[V], c byte, child *nodeHeader[V]) *nodeHeader[V] {
 	idx := n.indexOf(c)
 	if idx < 0 {
 		// Child doesn't exist, don't do anything, this shouldn't really happen...
@@ -119,7 +121,7 @@ func (n *node48) replaceChild(txn *Txn, c byte, child *nodeHeader) *nodeHeader {
 
 // minChild returns the child node with the lowest key or nil if there are no
 // children.
-func (n *node48) minChild() *nodeHeader {
+func (n *node48[V]) minChild() *nodeHeader[V] {
 	// Find first byte index at which a child exists
 	for i := 0; i <= 255; i++ {
 		if n.index[i] > 0 {
@@ -131,7 +133,7 @@ func (n *node48) minChild() *nodeHeader {
 
 // maxChild returns the child node with the highest key or nil if there are no
 // children.
-func (n *node48) maxChild() *nodeHeader {
+func (n *node48[V]) maxChild() *nodeHeader[V] {
 	// Find last byte index at which a child exists
 	for i := 255; i >= 0; i-- {
 		if n.index[i] > 0 {
@@ -141,25 +143,33 @@ func (n *node48) maxChild() *nodeHeader {
 	return nil
 }
 
-// lowerBound returns the child node with the lowest key that is at least as
-// large as the search key or nil if there are no keys with a next-byte equal or
-// higher than c.
-func (n *node48) lowerBound(c byte) *nodeHeader {
-	if n.nChildren == 0 {
-		return nil
+// lowerBound returns the child with the lowest next byte that is at least c
+// along with that byte. c is an int so that 256 can be passed to mean past the
+// last possible child. If there is no such child -1 and nil are returned.
+func (n *node48[V]) lowerBound(c int) (int, *nodeHeader[V]) {
+	for i := c; i < 256; i++ {
+		if offset := n.index[i]; offset > 0 {
+			return i, n.children[offset-1]
+		}
 	}
-	// Iterate from the key offset until we find a child
-	for _, offset := range n.index[c:] {
-		if offset > 0 {
-			return n.children[offset-1]
+	return -1, nil
+}
+
+// upperBound returns the child with the highest next byte that is at most c
+// along with that byte. c is an int so that -1 can be passed to mean before the
+// first possible child. If there is no such child -1 and nil are returned.
+func (n *node48[V]) upperBound(c int) (int, *nodeHeader[V]) {
+	for i := min(c, 255); i >= 0; i-- {
+		if offset := n.index[i]; offset > 0 {
+			return i, n.children[offset-1]
 		}
 	}
-	return nil
+	return -1, nil
 }
 
 // copy returns a new copy of the current node with the same contents but a new
 // ID.
-func (n *node48) copy(txn *Txn) *nodeHeader {
+func (n *node48[V]) copy(txn *Txn[V]) *nodeHeader[V] {
 	nn := txn.newNode48()
 	copyInnerNodeHeader(&nn.innerNodeHeader, &n.innerNodeHeader)
 	// Copy index and children
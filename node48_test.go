@@ -17,19 +17,19 @@ func testNode48Index(t *testing.T, n int) []byte {
 }
 
 func TestNode48FindChild(t *testing.T) {
-	txn := &Txn{}
+	txn := &Txn[any]{}
 
 	tests := []struct {
 		name     string
 		index    []byte
-		children []*nodeHeader
+		children []*nodeHeader[any]
 		c        byte
 		wantKey  string
 	}{
 		{
 			name:     "empty",
 			index:    []byte{},
-			children: []*nodeHeader{},
+			children: []*nodeHeader[any]{},
 			c:        'a',
 			wantKey:  "",
 		},
@@ -85,9 +85,9 @@ func TestNode48FindChild(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			n := &node48{
-				innerNodeHeader: innerNodeHeader{
-					nodeHeader: nodeHeader{
+			n := &node48[any]{
+				innerNodeHeader: innerNodeHeader[any]{
+					nodeHeader: nodeHeader[any]{
 						id:  1,
 						typ: typNode48,
 					},
@@ -105,7 +105,7 @@ func TestNode48FindChild(t *testing.T) {
 }
 
 func TestNode48AddRemoveChild(t *testing.T) {
-	txn := &Txn{}
+	txn := &Txn[any]{}
 	require := require.New(t)
 
 	// Start with an empty node48
@@ -114,7 +114,7 @@ func TestNode48AddRemoveChild(t *testing.T) {
 	require.Equal(0, int(n.nChildren))
 	require.Equal(typNode48, n.typ)
 
-	var n48h *nodeHeader
+	var n48h *nodeHeader[any]
 
 	children := testMakeChildLeaves(t, txn, 49)
 
@@ -175,17 +175,46 @@ func TestNode48AddRemoveChild(t *testing.T) {
 	}
 }
 
+func TestNode48Grow(t *testing.T) {
+	txn := &Txn[any]{}
+	require := require.New(t)
+
+	// A full node48 with a prefix and an inner leaf
+	nh := &txn.newNode48().nodeHeader
+	nh.setPrefix([]byte("foo"))
+	nh.setInnerLeaf(testMakeLeaf(txn, "foo").leafNode())
+	children := testMakeChildLeaves(t, txn, 49)
+	for i, child := range children[0:48] {
+		nh = nh.addChild(txn, allTheBytes[i], child)
+	}
+	require.Equal(typNode48, nh.typ)
+
+	// Add child 49
+	nh = nh.addChild(txn, allTheBytes[48], children[48])
+	// Should grow to a node256 with all the children
+	require.Equal(typNode256, nh.typ)
+	require.Equal(49, int(nh.node256().nChildren))
+	for j, wantChild := range children {
+		assertChildHasLeaf(t, nh, allTheBytes[j], string(wantChild.leafNode().key))
+	}
+	// The prefix and inner leaf should have been kept
+	pLen, pBytes := nh.prefixFields()
+	require.Equal("foo", string(pBytes[0:*pLen]))
+	require.NotNil(nh.innerLeaf())
+	require.Equal("foo", string(nh.innerLeaf().key))
+}
+
 func TestNode48MinMaxChild(t *testing.T) {
-	txn := &Txn{}
+	txn := &Txn[any]{}
 
 	tests := []struct {
 		name             string
-		children         []*nodeHeader
+		children         []*nodeHeader[any]
 		wantMin, wantMax string
 	}{
 		{
 			name:     "empty",
-			children: []*nodeHeader{},
+			children: []*nodeHeader[any]{},
 			wantMin:  "",
 			wantMax:  "",
 		},
@@ -197,19 +226,19 @@ func TestNode48MinMaxChild(t *testing.T) {
 		},
 		{
 			name:     "one null",
-			children: []*nodeHeader{testMakeLeaf(txn, "\x00\x00\x00")},
+			children: []*nodeHeader[any]{testMakeLeaf(txn, "\x00\x00\x00")},
 			wantMin:  "\x00\x00\x00",
 			wantMax:  "\x00\x00\x00",
 		},
 		{
 			name:     "one str",
-			children: []*nodeHeader{testMakeLeaf(txn, "foo")},
+			children: []*nodeHeader[any]{testMakeLeaf(txn, "foo")},
 			wantMin:  "foo",
 			wantMax:  "foo",
 		},
 		{
 			name: "two str",
-			children: []*nodeHeader{
+			children: []*nodeHeader[any]{
 				testMakeLeaf(txn, "foo"),
 				testMakeLeaf(txn, "aaa"),
 			},
@@ -234,17 +263,17 @@ func TestNode48MinMaxChild(t *testing.T) {
 }
 
 func TestNode48LowerBound(t *testing.T) {
-	txn := &Txn{}
+	txn := &Txn[any]{}
 
 	tests := []struct {
 		name      string
-		children  []*nodeHeader
+		children  []*nodeHeader[any]
 		key       string
 		wantLower string
 	}{
 		{
 			name:      "empty",
-			children:  []*nodeHeader{},
+			children:  []*nodeHeader[any]{},
 			key:       "foo",
 			wantLower: "",
 		},
@@ -275,8 +304,66 @@ func TestNode48LowerBound(t *testing.T) {
 				n = n.addChild(txn, child.leafNode().key[0], child)
 			}
 
-			gotLower := n.lowerBound(tt.key[0])
+			edge, gotLower := n.lowerBound(int(tt.key[0]))
 			assertLeafKey(t, gotLower, tt.wantLower)
+			if tt.wantLower == "" {
+				require.Equal(t, -1, edge)
+			} else {
+				require.Equal(t, int(tt.wantLower[0]), edge)
+			}
+		})
+	}
+}
+
+func TestNode48UpperBound(t *testing.T) {
+	txn := &Txn[any]{}
+
+	tests := []struct {
+		name      string
+		children  []*nodeHeader[any]
+		key       string
+		wantUpper string
+	}{
+		{
+			name:      "empty",
+			children:  []*nodeHeader[any]{},
+			key:       "foo",
+			wantUpper: "",
+		},
+		{
+			name:      "full, match",
+			children:  testMakeChildLeaves(t, txn, 48),
+			key:       "aaa",
+			wantUpper: "aaa",
+		},
+		{
+			name:      "full, no match",
+			children:  testMakeChildLeaves(t, txn, 48),
+			key:       "bbb",
+			wantUpper: "aaa",
+		},
+		{
+			name:      "full, last",
+			children:  testMakeChildLeaves(t, txn, 48),
+			key:       "\xff",
+			wantUpper: "\xff\xff\xff",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			n := &txn.newNode48().nodeHeader
+			for _, child := range tt.children {
+				n = n.addChild(txn, child.leafNode().key[0], child)
+			}
+
+			edge, gotUpper := n.upperBound(int(tt.key[0]))
+			assertLeafKey(t, gotUpper, tt.wantUpper)
+			if tt.wantUpper == "" {
+				require.Equal(t, -1, edge)
+			} else {
+				require.Equal(t, int(tt.wantUpper[0]), edge)
+			}
 		})
 	}
 }
@@ -7,18 +7,18 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
-func testMakeLeaf(txn *Txn, key string) *nodeHeader {
+func testMakeLeaf(txn *Txn[any], key string) *nodeHeader[any] {
 	l := txn.newLeafNode([]byte(key), key)
 	return &l.nodeHeader
 }
 
-func assertChildHasLeaf(t *testing.T, n *nodeHeader, c byte, key string) {
+func assertChildHasLeaf(t *testing.T, n *nodeHeader[any], c byte, key string) {
 	t.Helper()
 	child := n.findChild(c)
 	assertLeafKey(t, child, key)
 }
 
-func assertLeafKey(t *testing.T, n *nodeHeader, key string) {
+func assertLeafKey(t *testing.T, n *nodeHeader[any], key string) {
 	t.Helper()
 	if key == "" {
 		require.Nil(t, n)
@@ -31,54 +31,54 @@ func assertLeafKey(t *testing.T, n *nodeHeader, key string) {
 }
 
 func TestNode4FindChild(t *testing.T) {
-	txn := &Txn{}
+	txn := &Txn[any]{}
 
 	tests := []struct {
 		name     string
 		index    []byte
-		children []*nodeHeader
+		children []*nodeHeader[any]
 		c        byte
 		wantKey  string
 	}{
 		{
 			name:     "empty",
 			index:    []byte{},
-			children: []*nodeHeader{},
+			children: []*nodeHeader[any]{},
 			c:        'a',
 			wantKey:  "",
 		},
 		{
 			name:     "one-found",
 			index:    []byte{'f'},
-			children: []*nodeHeader{testMakeLeaf(txn, "foo")},
+			children: []*nodeHeader[any]{testMakeLeaf(txn, "foo")},
 			c:        'f',
 			wantKey:  "foo",
 		},
 		{
 			name:     "two-found-0",
 			index:    []byte{'b', 'f'},
-			children: []*nodeHeader{testMakeLeaf(txn, "bar"), testMakeLeaf(txn, "foo")},
+			children: []*nodeHeader[any]{testMakeLeaf(txn, "bar"), testMakeLeaf(txn, "foo")},
 			c:        'b',
 			wantKey:  "bar",
 		},
 		{
 			name:     "two-found-1",
 			index:    []byte{'b', 'f'},
-			children: []*nodeHeader{testMakeLeaf(txn, "bar"), testMakeLeaf(txn, "foo")},
+			children: []*nodeHeader[any]{testMakeLeaf(txn, "bar"), testMakeLeaf(txn, "foo")},
 			c:        'f',
 			wantKey:  "foo",
 		},
 		{
 			name:     "two-not-found",
 			index:    []byte{'b', 'f'},
-			children: []*nodeHeader{testMakeLeaf(txn, "bar"), testMakeLeaf(txn, "foo")},
+			children: []*nodeHeader[any]{testMakeLeaf(txn, "bar"), testMakeLeaf(txn, "foo")},
 			c:        'a',
 			wantKey:  "",
 		},
 		{
 			name:  "full-found-0",
 			index: []byte{0x0, 'b', 'f', 0xFF},
-			children: []*nodeHeader{
+			children: []*nodeHeader[any]{
 				testMakeLeaf(txn, "\x00\x00\x00"),
 				testMakeLeaf(txn, "bar"),
 				testMakeLeaf(txn, "foo"),
@@ -90,7 +90,7 @@ func TestNode4FindChild(t *testing.T) {
 		{
 			name:  "full-found-1",
 			index: []byte{0x0, 'b', 'f', 0xFF},
-			children: []*nodeHeader{
+			children: []*nodeHeader[any]{
 				testMakeLeaf(txn, "\x00\x00\x00"),
 				testMakeLeaf(txn, "bar"),
 				testMakeLeaf(txn, "foo"),
@@ -102,7 +102,7 @@ func TestNode4FindChild(t *testing.T) {
 		{
 			name:  "full-not-found",
 			index: []byte{0x0, 'b', 'f', 0xFF},
-			children: []*nodeHeader{
+			children: []*nodeHeader[any]{
 				testMakeLeaf(txn, "\x00\x00\x00"),
 				testMakeLeaf(txn, "bar"),
 				testMakeLeaf(txn, "foo"),
@@ -114,9 +114,9 @@ func TestNode4FindChild(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			n := &node4{
-				innerNodeHeader: innerNodeHeader{
-					nodeHeader: nodeHeader{
+			n := &node4[any]{
+				innerNodeHeader: innerNodeHeader[any]{
+					nodeHeader: nodeHeader[any]{
 						id:  1,
 						typ: typNode4,
 					},
@@ -134,7 +134,7 @@ func TestNode4FindChild(t *testing.T) {
 }
 
 func TestNode4AddRemoveChild(t *testing.T) {
-	txn := &Txn{}
+	txn := &Txn[any]{}
 	require := require.New(t)
 
 	// Start with an empty node4
@@ -237,6 +237,36 @@ func TestNode4AddRemoveChild(t *testing.T) {
 	require.Equal(0, int(gotN.nChildren))
 }
 
+func TestNode4Grow(t *testing.T) {
+	txn := &Txn[any]{}
+	require := require.New(t)
+
+	// A full node4 with a prefix and an inner leaf
+	nh := &txn.newNode4().nodeHeader
+	nh.setPrefix([]byte("foo"))
+	nh.setInnerLeaf(testMakeLeaf(txn, "foo").leafNode())
+	for _, c := range []byte("abcd") {
+		nh = nh.addChild(txn, c, testMakeLeaf(txn, string([]byte{c, c, c})))
+	}
+	require.Equal(typNode4, nh.typ)
+
+	// Add a child that sorts after all the others
+	nh = nh.addChild(txn, 'z', testMakeLeaf(txn, "zzz"))
+	// Should grow to a node16 with the new child last
+	require.Equal(typNode16, nh.typ)
+	n16 := nh.node16()
+	require.Equal(5, int(n16.nChildren))
+	require.Equal("abcdz", string(n16.index[0:5]))
+	for _, c := range []byte("abcdz") {
+		assertChildHasLeaf(t, nh, c, string([]byte{c, c, c}))
+	}
+	// The prefix and inner leaf should have been kept
+	pLen, pBytes := nh.prefixFields()
+	require.Equal("foo", string(pBytes[0:*pLen]))
+	require.NotNil(nh.innerLeaf())
+	require.Equal("foo", string(nh.innerLeaf().key))
+}
+
 func TestNode4MinMaxChild(t *testing.T) {
 	tests := []struct {
 		name             string
@@ -276,7 +306,7 @@ func TestNode4MinMaxChild(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			txn := &Txn{}
+			txn := &Txn[any]{}
 
 			n := &txn.newNode4().nodeHeader
 			for _, k := range tt.children {
@@ -326,15 +356,72 @@ func TestNode4LowerBound(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			txn := &Txn{}
+			txn := &Txn[any]{}
 
 			n := &txn.newNode4().nodeHeader
 			for _, k := range tt.children {
 				n = n.addChild(txn, k[0], testMakeLeaf(txn, k))
 			}
 
-			gotLower := n.lowerBound(tt.key[0])
+			edge, gotLower := n.lowerBound(int(tt.key[0]))
 			assertLeafKey(t, gotLower, tt.wantLower)
+			if tt.wantLower == "" {
+				require.Equal(t, -1, edge)
+			} else {
+				require.Equal(t, int(tt.wantLower[0]), edge)
+			}
+		})
+	}
+}
+
+func TestNode4UpperBound(t *testing.T) {
+	tests := []struct {
+		name      string
+		children  []string
+		key       string
+		wantUpper string
+	}{
+		{
+			name:      "empty",
+			children:  []string{},
+			key:       "foo",
+			wantUpper: "",
+		},
+		{
+			name:      "full, match",
+			children:  []string{"foo", "bar", "\x00\x00\x00", "\xff\xff\xff"},
+			key:       "foo",
+			wantUpper: "foo",
+		},
+		{
+			name:      "full, no match",
+			children:  []string{"foo", "bar", "\x00\x00\x00", "\xff\xff\xff"},
+			key:       "car",
+			wantUpper: "bar",
+		},
+		{
+			name:      "partial, none lower",
+			children:  []string{"foo", "bar"},
+			key:       "aaa",
+			wantUpper: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			txn := &Txn[any]{}
+
+			n := &txn.newNode4().nodeHeader
+			for _, k := range tt.children {
+				n = n.addChild(txn, k[0], testMakeLeaf(txn, k))
+			}
+
+			edge, gotUpper := n.upperBound(int(tt.key[0]))
+			assertLeafKey(t, gotUpper, tt.wantUpper)
+			if tt.wantUpper == "" {
+				require.Equal(t, -1, edge)
+			} else {
+				require.Equal(t, int(tt.wantUpper[0]), edge)
+			}
 		})
 	}
 }
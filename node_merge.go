@@ -1,198 +1,202 @@
 package art
 
-/*
-// mergeUpdates recursively merges the passed node as if it contains a tree of
-// new values to insert or replace the current tree with. This is used in
-// transactions on the immutable radix to merge the update set with the current
-// tree. If we end up not changing n, it is returned as-is, but any changes to n
-// result in a new node being created to preserve nodes in the committed tree
-// being modified when they may be being accessed. updateNode however may be
-// re-used as it's transaction local and nothing else is able to access it yet.
-// This saves re-allocating nodes used in the transaction's update set in many
-// cases.
+import (
+	"sort"
+)
+
+// BatchMerge can be used to toggle batch mode for the transaction. In batch
+// mode writes are buffered in a private tree that is merged with the snapshot
+// in a single pass when the transaction is committed, rather than each write
+// copying its own path through the tree. This suits large imports where many
+// writes land under the same nodes.
 //
-// snapMaxID must be a value greater that or equal to the highest node ID in the
-// snapshot being modified (i.e. invariant: n.id <= snapMaxID) and strictly less
-// than and node ID in the update tree (invariant: un.id > snapMaxID).
-//
-// The removed slice if non-nil, will be populated with the IDs of every node in
-// the current snapshot that will no longer be in the new snapshot. This allows
-// efficient "watching" for changes in bulk based on IDs rather than watching
-// arbitrarily many channels.
-func (n *nodeHeader) mergeUpdates(snapMaxID uint64, un *nodeHeader,
-	removed *[]uint64) *nodeHeader {
-	if un == nil {
-		return n
+// Get is answered from the buffer without merging, but anything that needs
+// the whole tree, such as Root, GetWatch or DeletePrefix, merges the pending
+// writes first. Turning batch mode off also merges them.
+func (t *Txn[V]) BatchMerge(batch bool) {
+	if !batch {
+		t.flush()
 	}
+	t.batch = batch
+}
 
-	commonPfx := uint8(longestPrefix(n.prefix[0:n.prefixLen], un.prefix[0:un.prefixLen]))
-
-	// Assume we don't have to modify this node. If we do, we replace this with a
-	// copy once and mutate the copy.
-	newNode := n
-
-	trackRemove := func(id uint64) {
-		if removed != nil {
-			*removed = append(*removed, id)
-		}
+// bufferInsert records an insert in the update tree. It returns the previous
+// value and whether there was one, taking into account any buffered writes.
+func (t *Txn[V]) bufferInsert(k []byte, v V) (V, bool) {
+	var oldVal V
+	var existed bool
+	if leaf := t.updates.findLeaf(k); leaf != nil {
+		oldVal, existed = leaf.value, true
+	} else if _, ok := t.deletes[string(k)]; ok {
+		// Re-inserted so the snapshot's leaf is replaced rather than deleted.
+		delete(t.deletes, string(k))
+	} else if leaf := t.root.findLeaf(k); leaf != nil {
+		oldVal, existed = leaf.value, true
 	}
+	// Every node in the update tree is new in this transaction so this never
+	// copies or discards anything.
+	t.updates, _, _ = t.insert(t.updates, t.newLeafNode(k, v), 0)
+	return oldVal, existed
+}
 
-	copyNode := func() {
-		if newNode.id == n.id {
-			newNode = n.copy()
-			trackRemove(n.id)
+// bufferDelete removes k from the update tree and records it to be deleted
+// from the snapshot if it's there. It returns the removed leaf if any.
+func (t *Txn[V]) bufferDelete(k []byte) *leafNode[V] {
+	if _, ok := t.deletes[string(k)]; ok {
+		return nil
+	}
+	newUpdates, oldLeaf := t.delete(t.updates, k, 0)
+	t.updates = newUpdates
+	if leaf := t.root.findLeaf(k); leaf != nil {
+		if t.deletes == nil {
+			t.deletes = make(map[string]struct{})
+		}
+		t.deletes[string(k)] = struct{}{}
+		if oldLeaf == nil {
+			oldLeaf = leaf
 		}
 	}
+	return oldLeaf
+}
 
-	switch n.typ {
+// bufferGet looks up k taking into account any buffered writes.
+func (t *Txn[V]) bufferGet(k []byte) (V, bool) {
+	var zero V
+	if _, ok := t.deletes[string(k)]; ok {
+		return zero, false
+	}
+	if leaf := t.updates.findLeaf(k); leaf != nil {
+		return leaf.value, true
+	}
+	if leaf := t.root.findLeaf(k); leaf != nil {
+		return leaf.value, true
+	}
+	return zero, false
+}
 
-	// Both have the same prefix (commonPrefix is the whole of both prefixes).
-	// We need to merge the edges recursively.
-	case commonPfx == n.prefixLen && commonPfx == un.prefixLen:
-		if n.nChildren == 0 {
-			// n had no children and same prefix so just use the update (sub)tree
-			// directly. We are implicitly removing n from the tree so track that.
-			trackRemove(n.id)
-			return un
+// flush applies any buffered writes to the root. The buffered deletes and
+// updates never contain the same key so they can be applied in either order.
+func (t *Txn[V]) flush() {
+	if len(t.deletes) > 0 {
+		keys := make([]string, 0, len(t.deletes))
+		for k := range t.deletes {
+			keys = append(keys, k)
 		}
-		// Merge recursively
-		for i := byte(0); i <= 255; i++ {
-			foundInN := n.indexOf(i) > -1
-			foundInUN := un.indexOf(i) > -1
-			switch n.typ {
-			case foundInN && foundInUN:
-				// Found in both, merge
-				copyNode()
-				newNode.replaceChild(i,
-					newNode.childAt(i).mergeUpdates(snapMaxID, un.childAt(i), removed))
-
-			case foundInN:
-				// We have it, un doesn't so no change needed
-				continue
-
-			case foundInUN:
-				// We don't have it but un does so just use the updated subtree
-				copyNode()
-				newNode.addChild(i, un.childAt(i))
-
-		case typNode256:
-				// Neither has it, just carry on the loop!
-			}
-		}
-		// If the other has a leaf and we don't, use their leaf value
-		if un.leaf != nil {
-			copyNode()
-			newNode.leaf = un.leaf
+		// Sort so node IDs are assigned deterministically.
+		sort.Strings(keys)
+		for _, k := range keys {
+			t.root, _ = t.delete(t.root, []byte(k), 0)
 		}
-		// If the node ended up with only one child, collapse it with the child if
-		// possible.
-		if newNode.nChildren == 1 {
-			newNode = newNode.mergeWithChild(snapMaxID)
-		}
-		return newNode
+		t.deletes = nil
+	}
+	if t.updates != nil {
+		t.root = t.mergeUpdates(t.root, t.updates, 0)
+		t.updates = nil
+	}
+}
 
-	// The update node is a prefix of this node.
-	case commonPfx == un.prefixLen:
-		copyNode()
-		// We insert n as a child of un with the common prefix removed
-		newNode.leftTrimPrefix(commonPfx)
-		// Then merge newNode as a child of un
-		un.mergeChildUpdates(snapMaxID, newNode.prefix[0], newNode, false, removed)
-		if un.nChildren == 1 {
-			un = un.mergeWithChild(snapMaxID)
-		}
+// mergeUpdates recursively merges the update tree un into n, both of which
+// cover keys starting with the same depth bytes. Values in un take precedence.
+// If n is from the snapshot it is copied at most once, and nodes of un are
+// reused wherever possible since nothing else can see them. Every snapshot
+// node that is replaced is discarded so its watchers are notified.
+func (t *Txn[V]) mergeUpdates(n, un *nodeHeader[V], depth int) *nodeHeader[V] {
+	switch {
+	case n == nil:
 		return un
 
-	// This node is a prefix of the update node
-	case commonPfx == n.prefixLen:
-		copyNode()
-		// We insert the other node as a child, possibly merging it with an existing
-		// child we have.
-		// Remove the common prefix from the update node.
-		un.leftTrimPrefix(commonPfx)
-		// Then merge update node as a child of newNode
-		newNode.mergeChildUpdates(snapMaxID, un.prefix[0], un, false, removed)
-		if newNode.nChildren == 1 {
-			newNode = newNode.mergeWithChild(snapMaxID)
+	case un.typ == typLeaf:
+		// A single update is just an insert.
+		newNode, _, _ := t.insert(n, un.leafNode(), depth)
+		return newNode
+
+	case n.typ == typLeaf:
+		// Insert the existing leaf into the update tree unless it's been
+		// replaced. The leaf is reused as is so isn't discarded in that case.
+		leaf := n.leafNode()
+		if un.findLeafAt(leaf.key, depth) != nil {
+			t.discard(n)
+			return un
 		}
+		newNode, _, _ := t.insert(un, leaf, depth)
 		return newNode
+	}
 
-	// Both nodes have a non-zero common prefix but neither is a full prefix of
-	// the other. Create a new parent with that prefix and insert both children.
-case typNode256:
-		newParent := newNode4()
-		// Give parent the common prefix
-		newParent.prefixLen = commonPfx
-		copy(newParent.prefix[0:commonPfx], n.prefix[0:commonPfx])
-
-		// Copy this node to remove it's prefix
-		copyNode()
-		newNode.leftTrimPrefix(commonPfx)
-		newParent.addChild(newNode.prefix[0], newNode)
-		// Add update node with prefix trimmed
-		un.leftTrimPrefix(commonPfx)
-		newParent.addChild(un.prefix[0], un)
-		return n
+	// Both are inner nodes, compare the whole prefixes since keys below either
+	// may be anywhere in the other.
+	prefix := n.prefix(depth)
+	uPrefix := un.prefix(depth)
+	lcp := longestPrefix(prefix, uPrefix)
+
+	switch {
+	case lcp == len(prefix) && lcp == len(uPrefix):
+		// Same prefix so merge the inner leaf and children.
+		newNode := t.copyIfNeeded(n)
+		if leaf := un.innerLeaf(); leaf != nil {
+			if old := newNode.innerLeaf(); old != nil {
+				t.discard(&old.nodeHeader)
+			}
+			newNode.setInnerLeaf(leaf)
+		}
+		return t.mergeChildren(newNode, un, depth+lcp+1)
+
+	case lcp == len(uPrefix):
+		// The update node's prefix is shorter so n becomes one of its children.
+		// Read the edge first since prefix may be n's own prefix array.
+		edge := prefix[lcp]
+		newNode := t.copyIfNeeded(n)
+		newNode.setPrefix(prefix[lcp+1:])
+		return t.mergeChild(un, edge, newNode, depth+lcp+1, false)
+
+	case lcp == len(prefix):
+		// Our prefix is shorter so un becomes one of our children.
+		edge := uPrefix[lcp]
+		un.setPrefix(uPrefix[lcp+1:])
+		newNode := t.copyIfNeeded(n)
+		return t.mergeChild(newNode, edge, un, depth+lcp+1, true)
 	}
-}
 
-// mergeDeletes is like mergeUpdates but takes a tree of keys that have been
-// deleted in a transaction and applies it recursively to the current tree with
-// copy-on-write semantics.
-func (n *nodeHeader) mergeDeletes(deleteNode *nodeHeader) *nodeHeader {
-	return n
+	// The prefixes differ part way so we need a new parent with the common part
+	// and both as children.
+	splitNode := &t.newNode4().nodeHeader
+	splitNode.setPrefix(prefix[0:lcp])
+
+	edge, uEdge := prefix[lcp], uPrefix[lcp]
+	newNode := t.copyIfNeeded(n)
+	newNode.setPrefix(prefix[lcp+1:])
+	un.setPrefix(uPrefix[lcp+1:])
+	splitNode = splitNode.addChild(t, edge, newNode)
+	return splitNode.addChild(t, uEdge, un)
 }
 
-// mergeWithChild is called if this node ends up having only one child provided
-// the merged prefix is less than MaxPrefixLen. By definition a node with only
-// one child must be a node4 but the child could be any type so we actually want
-// to modify the child to expand it's prefix if possible then replace ourselves
-// with it.
-func (n *nodeHeader) mergeWithChild(snapMaxID uint64) *nodeHeader {
-	// Check if our prefix fits in the child
-	child := n.minChild()
-	if (child.prefixLen + n.prefixLen) > maxPrefixLen {
-		// Can't merge as we don't have space.
-		return n
-	}
-
-	// We need to update the child's prefix. See if it was created during this
-	// transaction already or part of the snapshot.
-	if child.id <= snapMaxID {
-		// Was part of the snapshot, need to copy it before we can mutate
-		child = child.copy()
+// mergeChildren merges every child of the update node un into n which must
+// already be mutable. depth is the number of key bytes before the children.
+func (t *Txn[V]) mergeChildren(n, un *nodeHeader[V], depth int) *nodeHeader[V] {
+	for c := 0; c < 256; {
+		edge, child := un.lowerBound(c)
+		if child == nil {
+			break
+		}
+		n = t.mergeChild(n, byte(edge), child, depth, true)
+		c = edge + 1
 	}
-
-	newLen := child.prefixLen + n.prefixLen
-	// Move current prefix up by the difference
-	copy(child.prefix[n.prefixLen:newLen], child.prefix[0:child.prefixLen])
-	// Copy parent prefix into child
-	copy(child.prefix[0:n.prefixLen], n.prefix[0:n.prefixLen])
-	// Update length
-	child.prefixLen = newLen
-	return child
+	return n
 }
 
-// mergeChild merges the given child with the node own child at the same next
-// byte. It assumes n is already mutable.
-func (n *nodeHeader) mergeChildUpdates(snapMaxID uint64, c byte, child *nodeHeader, childIsUpdateNode bool, removed *[]uint64) {
-	existingChild := n.childAt(c)
-	if existingChild == nil {
-		// Nothing to merge with, just add it and be done!
-		n.addChild(c, child)
-		return
+// mergeChild adds child to n, which must already be mutable, under edge c. If
+// n already has a child there the two are merged. childIsUpdate says which of
+// them came from the update tree so its values take precedence. It returns n
+// or its replacement if it had to grow.
+func (t *Txn[V]) mergeChild(n *nodeHeader[V], c byte, child *nodeHeader[V], depth int, childIsUpdate bool) *nodeHeader[V] {
+	existing := n.findChild(c)
+	if existing == nil {
+		return n.addChild(t, c, child)
 	}
-
-	// Need to merge with existing child
-	var newChild *nodeHeader
-	if childIsUpdateNode {
-		newChild = existingChild.mergeUpdates(snapMaxID, child, removed)
+	var merged *nodeHeader[V]
+	if childIsUpdate {
+		merged = t.mergeUpdates(existing, child, depth)
 	} else {
-		// In this case the child being passed is the original snapshot node being
-		// merged into the update node (n), We need to reverse the order of merge to
-		// make sure leaf updates take precedence as we recurse.
-		newChild = child.mergeUpdates(snapMaxID, existingChild, removed)
+		merged = t.mergeUpdates(child, existing, depth)
 	}
-	n.replaceChild(c, newChild)
+	return n.replaceChild(t, c, merged)
 }
-*/
@@ -0,0 +1,145 @@
+package art
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testReachableIDs returns the IDs of every node in the tree rooted at n.
+func testReachableIDs(n *nodeHeader[any], ids map[uint64]struct{}) {
+	if n == nil {
+		return
+	}
+	ids[n.id] = struct{}{}
+	if n.typ == typLeaf {
+		return
+	}
+	if leaf := n.innerLeaf(); leaf != nil {
+		ids[leaf.id] = struct{}{}
+	}
+	for _, child := range n.childSlice() {
+		testReachableIDs(child, ids)
+	}
+}
+
+// testAssertDiscarded checks that the mutateSet of a committed txn holds
+// exactly the nodes of the snapshot that aren't in the new tree.
+func testAssertDiscarded(t *testing.T, snap, committed *Tree[any], mutateSet map[uint64]*bool) {
+	t.Helper()
+	before := make(map[uint64]struct{})
+	testReachableIDs(snap.root, before)
+	after := make(map[uint64]struct{})
+	testReachableIDs(committed.root, after)
+
+	want := make(map[uint64]struct{})
+	for id := range before {
+		if _, ok := after[id]; !ok {
+			want[id] = struct{}{}
+		}
+	}
+	got := make(map[uint64]struct{})
+	for id := range mutateSet {
+		got[id] = struct{}{}
+	}
+	require.Equal(t, want, got)
+}
+
+// testCollectPairs returns every key and value in the tree in order.
+func testCollectPairs(tree *Tree[any]) []string {
+	var pairs []string
+	it := tree.Root().Iterator()
+	for k, v, ok := it.Next(); ok; k, v, ok = it.Next() {
+		pairs = append(pairs, fmt.Sprintf("%q=%v", k, v))
+	}
+	return pairs
+}
+
+func TestTxnBatchMerge(t *testing.T) {
+	keys := testKeys()
+
+	for seed := int64(0); seed < 50; seed++ {
+		t.Run(fmt.Sprintf("seed-%d", seed), func(t *testing.T) {
+			require := require.New(t)
+			r := rand.New(rand.NewSource(seed))
+
+			tree := New()
+			for i := 0; i < 20; i++ {
+				// Run the same writes with and without batching and check they agree
+				// at every step.
+				txn := tree.Txn()
+				txn.TrackChanges(true)
+				batch := tree.Txn()
+				batch.TrackChanges(true)
+				batch.BatchMerge(true)
+
+				for j := 0; j < r.Intn(50)+1; j++ {
+					k := []byte(keys[r.Intn(len(keys))])
+					switch op := r.Intn(20); {
+					case op < 12:
+						v := fmt.Sprintf("%s-%d-%d", k, i, j)
+						old, ok := txn.Insert(k, v)
+						bOld, bOK := batch.Insert(k, v)
+						require.Equal(ok, bOK, "insert %q", k)
+						require.Equal(old, bOld, "insert %q", k)
+					case op < 18:
+						old, ok := txn.Delete(k)
+						bOld, bOK := batch.Delete(k)
+						require.Equal(ok, bOK, "delete %q", k)
+						require.Equal(old, bOld, "delete %q", k)
+					case op < 19:
+						p := k[0:r.Intn(len(k)+1)]
+						require.Equal(txn.DeletePrefix(p), batch.DeletePrefix(p))
+					default:
+						k2 := []byte(keys[r.Intn(len(keys))])
+						v, ok := txn.Get(k2)
+						bV, bOK := batch.Get(k2)
+						require.Equal(ok, bOK, "get %q", k2)
+						require.Equal(v, bV, "get %q", k2)
+					}
+					require.Equal(txn.Len(), batch.Len())
+				}
+
+				want := txn.Commit()
+				got := batch.Commit()
+				require.Equal(want.Len(), got.Len())
+				require.Equal(testCollectPairs(want), testCollectPairs(got))
+				require.Equal(txn.Changes(), batch.Changes())
+				testAssertCompressed(t, got.root)
+				require.NoError(got.Validate())
+				testAssertDiscarded(t, tree, got, batch.mutateSet)
+
+				tree = got
+			}
+		})
+	}
+}
+
+func TestTxnBatchMergeCopiesOnce(t *testing.T) {
+	require := require.New(t)
+
+	tree := testBuildTree(testKeys(), 1)
+
+	// Replace every value so every node needs copying.
+	txn := tree.Txn()
+	txn.BatchMerge(true)
+	for _, k := range testKeys() {
+		txn.Insert([]byte(k), k)
+	}
+	got := txn.Commit()
+
+	before := make(map[uint64]struct{})
+	testReachableIDs(tree.root, before)
+	after := make(map[uint64]struct{})
+	testReachableIDs(got.root, after)
+
+	// Nothing is shared and every old node was discarded.
+	require.Len(txn.mutateSet, len(before))
+	for id := range after {
+		require.NotContains(before, id)
+	}
+	require.Equal(testCollect(t, tree.Root().Iterator().Next),
+		testCollect(t, got.Root().Iterator().Next))
+}
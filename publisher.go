@@ -0,0 +1,226 @@
+package art
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// SlowConsumerPolicy decides what a Publisher does when a subscriber's buffer
+// is full.
+type SlowConsumerPolicy int
+
+const (
+	// PolicyDrop skips the event for that subscriber. The subscriber can tell
+	// it missed events since the next one's PrevIndex won't match the Index of
+	// the last one it saw.
+	PolicyDrop SlowConsumerPolicy = iota
+
+	// PolicyBlock waits for the subscriber to make room. Writers are blocked
+	// until it does, or until the subscription is closed. Tree doesn't block so
+	// the subscriber can still read the current tree, but calling Update while
+	// handling an event can deadlock.
+	PolicyBlock
+
+	// PolicyClose closes the subscription.
+	PolicyClose
+)
+
+// Event describes a single commit made through a Publisher.
+type Event[V any] struct {
+	Old     *Tree[V]
+	New     *Tree[V]
+	Changes []Change[V]
+}
+
+// Index is the sequence number of the event. It's the maxID of the new tree so
+// it's strictly increasing across events from the same Publisher, but not
+// contiguous.
+func (e Event[V]) Index() uint64 {
+	return e.New.maxID
+}
+
+// PrevIndex is the Index of the event that produced the old tree. If it's not
+// the Index of the last event seen by a subscriber then some were dropped.
+func (e Event[V]) PrevIndex() uint64 {
+	return e.Old.maxID
+}
+
+// Publisher owns the current version of a tree and publishes an Event to
+// every subscriber for each commit made through it. It's safe for concurrent
+// use.
+type Publisher[V any] struct {
+	// l serializes commits and protects subs.
+	l    sync.Mutex
+	subs map[*Subscription[V]]struct{}
+
+	// sendL is held while an event is delivered. It's taken before l is
+	// released so events are delivered in commit order, but readers of the
+	// current tree and the next writer's transaction don't wait for slow
+	// subscribers. Subscription channels are only closed while it's held.
+	sendL sync.Mutex
+
+	tree atomic.Pointer[Tree[V]]
+}
+
+// NewPublisher returns a Publisher starting from tree t.
+func NewPublisher[V any](t *Tree[V]) *Publisher[V] {
+	p := &Publisher[V]{
+		subs: make(map[*Subscription[V]]struct{}),
+	}
+	p.tree.Store(t)
+	return p
+}
+
+// Tree returns the current version of the tree. It never blocks, so it's safe
+// to call from a subscriber while handling an event.
+func (p *Publisher[V]) Tree() *Tree[V] {
+	return p.tree.Load()
+}
+
+// Update runs fn with a transaction on the current tree and commits it if fn
+// returns nil. Updates are serialized so events are published in commit order.
+// It returns the new current tree, which is unchanged if fn made no changes or
+// returned an error.
+func (p *Publisher[V]) Update(fn func(txn *Txn[V]) error) (*Tree[V], error) {
+	p.l.Lock()
+
+	old := p.tree.Load()
+	txn := old.Txn()
+	txn.TrackChanges(true)
+	if err := fn(txn); err != nil {
+		p.l.Unlock()
+		return old, err
+	}
+	// Apply any writes fn buffered with BatchMerge before checking for changes.
+	txn.flush()
+	if txn.root == txn.snap {
+		p.l.Unlock()
+		return old, nil
+	}
+	if txn.maxRootID == txn.maxSnapID {
+		// Deleting the only leaf doesn't allocate any nodes, make sure the new
+		// tree still gets a distinct Index.
+		txn.nextID()
+	}
+	newTree := txn.Commit()
+	p.tree.Store(newTree)
+
+	e := Event[V]{
+		Old:     old,
+		New:     newTree,
+		Changes: txn.Changes(),
+	}
+	subs := make([]*Subscription[V], 0, len(p.subs))
+	for s := range p.subs {
+		if s.isDone() {
+			// Closed by PolicyClose while publishing an earlier event.
+			delete(p.subs, s)
+			continue
+		}
+		subs = append(subs, s)
+	}
+
+	p.sendL.Lock()
+	defer p.sendL.Unlock()
+	p.l.Unlock()
+
+	for _, s := range subs {
+		p.publish(s, e)
+	}
+	return newTree, nil
+}
+
+// publish sends e to s according to its policy. p.sendL must be held.
+func (p *Publisher[V]) publish(s *Subscription[V], e Event[V]) {
+	if s.isDone() {
+		return
+	}
+	select {
+	case s.ch <- e:
+		return
+	default:
+	}
+
+	switch s.policy {
+	case PolicyBlock:
+		select {
+		case s.ch <- e:
+		case <-s.done:
+			// Closed while we were waiting, Close will finish up once we release
+			// the send lock.
+		}
+	case PolicyClose:
+		// It's removed from subs by the next Update.
+		s.closeDone()
+		s.closeCh()
+	}
+}
+
+// Subscribe returns a new subscription that receives an event for every later
+// commit. Up to buffer events are queued for it before policy applies.
+func (p *Publisher[V]) Subscribe(buffer int, policy SlowConsumerPolicy) *Subscription[V] {
+	s := &Subscription[V]{
+		p:      p,
+		ch:     make(chan Event[V], buffer),
+		done:   make(chan struct{}),
+		policy: policy,
+	}
+	p.l.Lock()
+	defer p.l.Unlock()
+	p.subs[s] = struct{}{}
+	return s
+}
+
+// Subscription receives the events published for commits made after it was
+// created.
+type Subscription[V any] struct {
+	p        *Publisher[V]
+	ch       chan Event[V]
+	done     chan struct{}
+	doneOnce sync.Once
+	policy   SlowConsumerPolicy
+
+	// chClosed is protected by p.sendL.
+	chClosed bool
+}
+
+// Events returns the channel events are delivered on. It's closed when the
+// subscription is closed, either by Close or by PolicyClose.
+func (s *Subscription[V]) Events() <-chan Event[V] {
+	return s.ch
+}
+
+// Close stops delivery of events to the subscription. It's safe to call more
+// than once and while the Publisher is blocked sending to it.
+func (s *Subscription[V]) Close() {
+	// Wake the publisher first in case it's blocked sending to us while holding
+	// the send lock.
+	s.closeDone()
+	s.p.l.Lock()
+	defer s.p.l.Unlock()
+	delete(s.p.subs, s)
+	s.p.sendL.Lock()
+	defer s.p.sendL.Unlock()
+	s.closeCh()
+}
+
+func (s *Subscription[V]) closeDone() {
+	s.doneOnce.Do(func() { close(s.done) })
+}
+
+func (s *Subscription[V]) isDone() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// closeCh closes the events channel. p.sendL must be held.
+func (s *Subscription[V]) closeCh() {
+	if !s.chClosed {
+		s.chClosed = true
+		close(s.ch)
+	}
+}
@@ -0,0 +1,239 @@
+package art
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testPublishInsert commits a single insert of k through p.
+func testPublishInsert(t *testing.T, p *Publisher[any], k string) *Tree[any] {
+	t.Helper()
+	tree, err := p.Update(func(txn *Txn[any]) error {
+		txn.Insert([]byte(k), k)
+		return nil
+	})
+	require.NoError(t, err)
+	return tree
+}
+
+func TestPublisherUpdate(t *testing.T) {
+	require := require.New(t)
+
+	p := NewPublisher(New())
+	sub := p.Subscribe(10, PolicyDrop)
+	defer sub.Close()
+
+	start := p.Tree()
+	tree := testPublishInsert(t, p, "foo")
+	require.Equal(tree, p.Tree())
+
+	e := <-sub.Events()
+	require.Equal(start, e.Old)
+	require.Equal(tree, e.New)
+	require.Equal(start.maxID, e.PrevIndex())
+	require.Equal(tree.maxID, e.Index())
+	require.Len(e.Changes, 1)
+	require.Equal([]byte("foo"), e.Changes[0].Key)
+	require.True(e.Changes[0].Created())
+
+	// An error discards the txn
+	_, err := p.Update(func(txn *Txn[any]) error {
+		txn.Insert([]byte("bar"), 1)
+		return errors.New("nope")
+	})
+	require.Error(err)
+	require.Equal(tree, p.Tree())
+
+	// No changes means no event
+	_, err = p.Update(func(txn *Txn[any]) error { return nil })
+	require.NoError(err)
+	require.Equal(tree, p.Tree())
+
+	// Deleting the only key allocates no nodes but must still get a new index
+	_, err = p.Update(func(txn *Txn[any]) error {
+		txn.Delete([]byte("foo"))
+		return nil
+	})
+	require.NoError(err)
+	e2 := <-sub.Events()
+	require.Equal(e.Index(), e2.PrevIndex())
+	require.Greater(e2.Index(), e.Index())
+	require.Equal(0, e2.New.Len())
+
+	select {
+	case e := <-sub.Events():
+		t.Fatalf("unexpected event %d", e.Index())
+	default:
+	}
+}
+
+func TestPublisherUpdateBatchMerge(t *testing.T) {
+	require := require.New(t)
+
+	p := NewPublisher(New())
+	sub := p.Subscribe(10, PolicyDrop)
+	defer sub.Close()
+
+	start := testPublishInsert(t, p, "foo")
+	<-sub.Events()
+
+	// Writes buffered in batch mode are still committed and published
+	tree, err := p.Update(func(txn *Txn[any]) error {
+		txn.BatchMerge(true)
+		txn.Insert([]byte("bar"), "bar")
+		txn.Insert([]byte("baz"), "baz")
+		txn.Delete([]byte("foo"))
+		return nil
+	})
+	require.NoError(err)
+	require.NotEqual(start, tree)
+	require.Equal(tree, p.Tree())
+	require.Equal(2, tree.Len())
+	_, ok := tree.Get([]byte("foo"))
+	require.False(ok)
+	v, ok := tree.Get([]byte("bar"))
+	require.True(ok)
+	require.Equal("bar", v)
+
+	e := <-sub.Events()
+	require.Equal(start, e.Old)
+	require.Equal(tree, e.New)
+	require.Len(e.Changes, 3)
+}
+
+func TestPublisherPolicyDrop(t *testing.T) {
+	require := require.New(t)
+
+	p := NewPublisher(New())
+	sub := p.Subscribe(2, PolicyDrop)
+	defer sub.Close()
+
+	for i := 0; i < 5; i++ {
+		testPublishInsert(t, p, fmt.Sprintf("key-%d", i))
+	}
+
+	// The first two were buffered and the rest dropped
+	e1 := <-sub.Events()
+	e2 := <-sub.Events()
+	require.Equal(e1.Index(), e2.PrevIndex())
+
+	// After the gap the next event doesn't follow on
+	testPublishInsert(t, p, "after")
+	e3 := <-sub.Events()
+	require.NotEqual(e2.Index(), e3.PrevIndex())
+	require.Equal("after", string(e3.Changes[0].Key))
+}
+
+func TestPublisherPolicyClose(t *testing.T) {
+	require := require.New(t)
+
+	p := NewPublisher(New())
+	slow := p.Subscribe(1, PolicyClose)
+	fast := p.Subscribe(10, PolicyClose)
+	defer fast.Close()
+
+	testPublishInsert(t, p, "a")
+	testPublishInsert(t, p, "b")
+
+	_, ok := <-slow.Events()
+	require.True(ok)
+	_, ok = <-slow.Events()
+	require.False(ok, "slow subscriber should have been closed")
+
+	// Closing again is fine
+	slow.Close()
+
+	for _, k := range []string{"a", "b"} {
+		e := <-fast.Events()
+		require.Equal(k, string(e.Changes[0].Key))
+	}
+}
+
+func TestPublisherPolicyBlock(t *testing.T) {
+	require := require.New(t)
+
+	p := NewPublisher(New())
+	sub := p.Subscribe(0, PolicyBlock)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			testPublishInsert(t, p, fmt.Sprintf("key-%03d", i))
+		}
+	}()
+
+	// Every event must arrive in order with no gaps
+	var last uint64
+	for i := 0; i < 100; i++ {
+		e := <-sub.Events()
+		if i > 0 {
+			require.Equal(last, e.PrevIndex())
+		}
+		require.Equal(fmt.Sprintf("key-%03d", i), string(e.Changes[0].Key))
+		last = e.Index()
+	}
+	wg.Wait()
+
+	// Closing unblocks a writer stuck on the subscriber
+	done := make(chan struct{})
+	go func() {
+		testPublishInsert(t, p, "stuck")
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("writer should be blocked")
+	case <-time.After(10 * time.Millisecond):
+	}
+	sub.Close()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("writer still blocked after close")
+	}
+	_, ok := <-sub.Events()
+	require.False(ok)
+}
+
+func TestPublisherPolicyBlockSubscriberReadsTree(t *testing.T) {
+	require := require.New(t)
+
+	p := NewPublisher(New())
+	sub := p.Subscribe(1, PolicyBlock)
+	defer sub.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 50; i++ {
+			testPublishInsert(t, p, fmt.Sprintf("key-%03d", i))
+		}
+	}()
+
+	// Reading the current tree while the writer is blocked on us must not
+	// deadlock, and it's never older than the event.
+	for i := 0; i < 50; i++ {
+		select {
+		case e := <-sub.Events():
+			cur := p.Tree()
+			require.GreaterOrEqual(cur.maxID, e.Index())
+			_, ok := cur.Get(e.Changes[0].Key)
+			require.True(ok)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for event %d", i)
+		}
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("writer still blocked")
+	}
+	require.Equal(50, p.Tree().Len())
+}
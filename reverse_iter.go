@@ -0,0 +1,131 @@
+package art
+
+import (
+	"bytes"
+)
+
+// ReverseIterator is used to iterate over a set of nodes in reverse
+// lexicographic order of their keys. An inner leaf is always visited after all
+// of the children of the same node since its key is a prefix of all of theirs.
+type ReverseIterator[V any] struct {
+	node  *nodeHeader[V]
+	stack []iterFrame[V]
+}
+
+// ReverseIterator is used to return an iterator at the given node to walk the
+// tree backwards.
+func (n *APINode[V]) ReverseIterator() *ReverseIterator[V] {
+	ri := &ReverseIterator[V]{node: n.h}
+	if n.h != nil {
+		ri.push(n.h)
+	}
+	return ri
+}
+
+// push adds a node to the stack such that all its children and inner leaf
+// will be visited. For reverse iteration next is the highest next byte of the
+// children still to be visited, or -1 once they are all done and only the
+// inner leaf is left.
+func (ri *ReverseIterator[V]) push(n *nodeHeader[V]) {
+	ri.stack = append(ri.stack, iterFrame[V]{n: n, next: 255})
+}
+
+// SeekPrefix is used to seek the iterator to a given prefix. Subsequent calls
+// to Previous will return only keys that start with prefix.
+func (ri *ReverseIterator[V]) SeekPrefix(prefix []byte) {
+	ri.stack = ri.stack[:0]
+	if n := ri.node.seekPrefix(prefix); n != nil {
+		ri.push(n)
+	}
+}
+
+// SeekReverseLowerBound is used to seek the iterator to the largest key that is
+// lower or equal to the given key.
+func (ri *ReverseIterator[V]) SeekReverseLowerBound(key []byte) {
+	ri.stack = ri.stack[:0]
+	n := ri.node
+	depth := 0
+	for n != nil {
+		if n.typ == typLeaf {
+			if bytes.Compare(n.leafNode().key, key) <= 0 {
+				ri.push(n)
+			}
+			return
+		}
+
+		// Compare the node prefix with the same number of bytes of the key. The
+		// whole prefix is needed since a mismatch in any byte decides the order
+		// of the whole subtree.
+		nodePrefix := n.prefix(depth)
+		remaining := key[depth:]
+		if len(remaining) > len(nodePrefix) {
+			remaining = remaining[0:len(nodePrefix)]
+		}
+		switch bytes.Compare(nodePrefix, remaining) {
+		case -1:
+			// Every key in this subtree is less than the search key.
+			ri.push(n)
+			return
+		case 1:
+			// Every key in this subtree is greater than the search key so nothing
+			// here. Any frames already on the stack hold the smaller keys.
+			return
+		}
+		depth += len(nodePrefix)
+
+		if depth > len(key) {
+			// The search key ends within the prefix so all keys below here are
+			// greater.
+			return
+		}
+		if depth == len(key) {
+			// The search key ends exactly at this node so only the inner leaf, if
+			// any, can be lower or equal. Push the node with no children left to
+			// visit.
+			ri.stack = append(ri.stack, iterFrame[V]{n: n, next: -1})
+			return
+		}
+
+		// The inner leaf and any children with a lower next byte sort before the
+		// search key and will be visited once the child that matches the next
+		// byte exactly (if any) is exhausted.
+		c := key[depth]
+		ri.stack = append(ri.stack, iterFrame[V]{n: n, next: int(c) - 1})
+
+		n = n.findChild(c)
+		depth++
+	}
+}
+
+// Previous returns the previous key and value in reverse order. The final
+// return is false once the iteration is exhausted.
+func (ri *ReverseIterator[V]) Previous() ([]byte, V, bool) {
+	var zero V
+	for len(ri.stack) > 0 {
+		f := &ri.stack[len(ri.stack)-1]
+
+		if f.n.typ == typLeaf {
+			ri.stack = ri.stack[:len(ri.stack)-1]
+			leaf := f.n.leafNode()
+			return leaf.key, leaf.value, true
+		}
+
+		if f.next >= 0 {
+			edge, child := f.n.upperBound(f.next)
+			if child != nil {
+				// Update the frame before pushing since that might move the stack.
+				f.next = edge - 1
+				ri.push(child)
+				continue
+			}
+		}
+
+		// Children exhausted, the inner leaf sorts before all of them so is last.
+		n := f.n
+		ri.stack = ri.stack[:len(ri.stack)-1]
+		if leaf := n.innerLeaf(); leaf != nil {
+			return leaf.key, leaf.value, true
+		}
+	}
+	return nil, zero, false
+}
@@ -0,0 +1,93 @@
+package art
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testReverse returns a reversed copy of keys or nil if there are none.
+func testReverse(keys []string) []string {
+	if len(keys) == 0 {
+		return nil
+	}
+	out := make([]string, len(keys))
+	for i, k := range keys {
+		out[len(keys)-1-i] = k
+	}
+	return out
+}
+
+func TestReverseIteratorPrevious(t *testing.T) {
+	keys := testKeys()
+	sorted := append([]string(nil), keys...)
+	sort.Strings(sorted)
+
+	for seed := int64(0); seed < 5; seed++ {
+		t.Run(fmt.Sprintf("seed-%d", seed), func(t *testing.T) {
+			tree := testBuildTree(keys, seed)
+			ri := tree.Root().ReverseIterator()
+			require.Equal(t, testReverse(sorted), testCollect(t, ri.Previous))
+
+			_, _, ok := ri.Previous()
+			require.False(t, ok)
+		})
+	}
+}
+
+func TestReverseIteratorEmpty(t *testing.T) {
+	ri := New().Root().ReverseIterator()
+	_, _, ok := ri.Previous()
+	require.False(t, ok)
+
+	ri.SeekReverseLowerBound([]byte("foo"))
+	_, _, ok = ri.Previous()
+	require.False(t, ok)
+}
+
+func TestReverseIteratorSeekPrefix(t *testing.T) {
+	keys := testKeys()
+	sorted := append([]string(nil), keys...)
+	sort.Strings(sorted)
+
+	tree := testBuildTree(keys, 2)
+
+	for _, p := range []string{"", "a", "b", "foo", "foo/", "wide/", "mid/",
+		testLongPrefix, testLongPrefix + "bb", "this/is/a/very/long/shared/prefiX"} {
+		t.Run(p, func(t *testing.T) {
+			var want []string
+			for _, k := range sorted {
+				if strings.HasPrefix(k, p) {
+					want = append(want, k)
+				}
+			}
+			ri := tree.Root().ReverseIterator()
+			ri.SeekPrefix([]byte(p))
+			require.Equal(t, testReverse(want), testCollect(t, ri.Previous))
+		})
+	}
+}
+
+func TestReverseIteratorSeekReverseLowerBound(t *testing.T) {
+	keys := testKeys()
+	sorted := append([]string(nil), keys...)
+	sort.Strings(sorted)
+
+	for seed := int64(0); seed < 3; seed++ {
+		tree := testBuildTree(keys, seed)
+
+		for _, s := range testSeekKeys(keys) {
+			// Find the index of the first key greater than s, everything before
+			// it is lower or equal.
+			idx := sort.Search(len(sorted), func(i int) bool { return sorted[i] > s })
+			want := testReverse(sorted[0:idx])
+
+			ri := tree.Root().ReverseIterator()
+			ri.SeekReverseLowerBound([]byte(s))
+			require.Equal(t, want, testCollect(t, ri.Previous), "seed %d seek %q", seed, s)
+		}
+	}
+}
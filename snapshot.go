@@ -0,0 +1,371 @@
+package art
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+)
+
+// Snapshots written by WriteTo are laid out as a header followed by blocks of
+// entries in key order and then an empty block to mark the end.
+//
+// The header is the magic bytes, a uint16 format version, two reserved bytes,
+// the uint64 number of keys and a CRC32 of everything before it. Each block is
+// a uint32 number of entries, a uint32 payload length, the payload and then a
+// CRC32 of the payload. The payload is each entry's key and encoded value,
+// both as a uvarint length followed by the bytes. Integers are big endian and
+// the CRCs use the IEEE polynomial.
+const (
+	snapshotMagic   = "iART"
+	snapshotVersion = 1
+
+	snapshotHeaderLen = 20
+
+	// snapshotBlockSize is the payload size after which a block is written out.
+	// Single entries larger than this get a block of their own.
+	snapshotBlockSize = 64 * 1024
+)
+
+// ErrCorruptSnapshot is returned, wrapped with details, by ReadTree when the
+// snapshot is not in a format it understands or fails a CRC or consistency
+// check.
+var ErrCorruptSnapshot = errors.New("corrupt snapshot")
+
+// ValueCodec encodes and decodes values for snapshots.
+type ValueCodec[V any] interface {
+	// AppendValue appends the encoding of v to b and returns the result.
+	AppendValue(b []byte, v V) ([]byte, error)
+
+	// DecodeValue decodes a value encoded by AppendValue. b is part of a buffer
+	// holding many entries so anything kept from it should be copied, otherwise
+	// it keeps the whole buffer alive.
+	DecodeValue(b []byte) (V, error)
+}
+
+// BytesCodec stores []byte values as is.
+type BytesCodec struct{}
+
+func (BytesCodec) AppendValue(b []byte, v []byte) ([]byte, error) {
+	return append(b, v...), nil
+}
+
+func (BytesCodec) DecodeValue(b []byte) ([]byte, error) {
+	return snapshotCopy(b), nil
+}
+
+// StringCodec stores string values as their bytes.
+type StringCodec struct{}
+
+func (StringCodec) AppendValue(b []byte, v string) ([]byte, error) {
+	return append(b, v...), nil
+}
+
+func (StringCodec) DecodeValue(b []byte) (string, error) {
+	return string(b), nil
+}
+
+// GobCodec stores each value with encoding/gob. Every value carries its own
+// type information so it's neither small nor fast, but works for most types.
+// Concrete types stored in interface values must be registered with
+// gob.Register as usual.
+type GobCodec[V any] struct{}
+
+func (GobCodec[V]) AppendValue(b []byte, v V) ([]byte, error) {
+	buf := bytes.NewBuffer(b)
+	if err := gob.NewEncoder(buf).Encode(&v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (GobCodec[V]) DecodeValue(b []byte) (V, error) {
+	var v V
+	err := gob.NewDecoder(bytes.NewReader(b)).Decode(&v)
+	return v, err
+}
+
+// defaultCodec returns the codec used by WriteTo and ReadTree for values of
+// type V.
+func defaultCodec[V any]() ValueCodec[V] {
+	var zero V
+	switch any(zero).(type) {
+	case []byte:
+		return any(BytesCodec{}).(ValueCodec[V])
+	case string:
+		return any(StringCodec{}).(ValueCodec[V])
+	}
+	return GobCodec[V]{}
+}
+
+// WriteTo writes a snapshot of the tree to w that can be loaded with
+// ReadTree. []byte and string values are stored as is, any other type is
+// stored with GobCodec. Use WriteToCodec to choose the encoding.
+func (t *Tree[V]) WriteTo(w io.Writer) (int64, error) {
+	return t.WriteToCodec(w, defaultCodec[V]())
+}
+
+// WriteToCodec writes a snapshot of the tree to w using codec to encode the
+// values. It returns the number of bytes written.
+func (t *Tree[V]) WriteToCodec(w io.Writer, codec ValueCodec[V]) (int64, error) {
+	sw := &snapshotWriter{w: w}
+
+	header := make([]byte, 0, snapshotHeaderLen)
+	header = append(header, snapshotMagic...)
+	header = binary.BigEndian.AppendUint16(header, snapshotVersion)
+	header = binary.BigEndian.AppendUint16(header, 0)
+	header = binary.BigEndian.AppendUint64(header, uint64(t.size))
+	header = binary.BigEndian.AppendUint32(header, crc32.ChecksumIEEE(header))
+	if err := sw.write(header); err != nil {
+		return sw.n, err
+	}
+
+	var payload []byte
+	numEntries := 0
+	it := t.Root().Iterator()
+	for k, v, ok := it.Next(); ok; k, v, ok = it.Next() {
+		payload = binary.AppendUvarint(payload, uint64(len(k)))
+		payload = append(payload, k...)
+
+		// Encode the value after leaving room for the longest possible length
+		// then move it back once we know how long it was.
+		lenOffset := len(payload)
+		payload = append(payload, make([]byte, binary.MaxVarintLen64)...)
+		var err error
+		payload, err = codec.AppendValue(payload, v)
+		if err != nil {
+			return sw.n, fmt.Errorf("failed to encode value for %q: %w", k, err)
+		}
+		valueLen := len(payload) - lenOffset - binary.MaxVarintLen64
+		n := binary.PutUvarint(payload[lenOffset:], uint64(valueLen))
+		copy(payload[lenOffset+n:], payload[lenOffset+binary.MaxVarintLen64:])
+		payload = payload[0 : lenOffset+n+valueLen]
+
+		numEntries++
+		if len(payload) >= snapshotBlockSize {
+			if err := sw.writeBlock(numEntries, payload); err != nil {
+				return sw.n, err
+			}
+			payload, numEntries = payload[:0], 0
+		}
+	}
+	if numEntries > 0 {
+		if err := sw.writeBlock(numEntries, payload); err != nil {
+			return sw.n, err
+		}
+	}
+	// The empty block marks the end.
+	err := sw.writeBlock(0, nil)
+	return sw.n, err
+}
+
+// snapshotWriter counts the bytes written.
+type snapshotWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (sw *snapshotWriter) write(b []byte) error {
+	n, err := sw.w.Write(b)
+	sw.n += int64(n)
+	return err
+}
+
+func (sw *snapshotWriter) writeBlock(numEntries int, payload []byte) error {
+	var hdr [8]byte
+	binary.BigEndian.PutUint32(hdr[0:4], uint32(numEntries))
+	binary.BigEndian.PutUint32(hdr[4:8], uint32(len(payload)))
+	if err := sw.write(hdr[:]); err != nil {
+		return err
+	}
+	if err := sw.write(payload); err != nil {
+		return err
+	}
+	var crc [4]byte
+	binary.BigEndian.PutUint32(crc[:], crc32.ChecksumIEEE(payload))
+	return sw.write(crc[:])
+}
+
+// ReadTree loads a tree from a snapshot written by WriteTo. The value type
+// must match the one the snapshot was written with.
+func ReadTree[V any](r io.Reader) (*Tree[V], error) {
+	return ReadTreeCodec(r, defaultCodec[V]())
+}
+
+// ReadTreeCodec loads a tree from a snapshot written by WriteToCodec using
+// codec to decode the values. The tree is built directly from the sorted keys
+// rather than by inserting them one at a time. Errors in the format are
+// wrapped ErrCorruptSnapshot.
+func ReadTreeCodec[V any](r io.Reader, codec ValueCodec[V]) (*Tree[V], error) {
+	br := bufio.NewReader(r)
+
+	var header [snapshotHeaderLen]byte
+	if _, err := io.ReadFull(br, header[:]); err != nil {
+		return nil, snapshotReadErr("header", err)
+	}
+	if string(header[0:4]) != snapshotMagic {
+		return nil, fmt.Errorf("%w: bad magic %q", ErrCorruptSnapshot, header[0:4])
+	}
+	if v := binary.BigEndian.Uint16(header[4:6]); v != snapshotVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrCorruptSnapshot, v)
+	}
+	if crc := binary.BigEndian.Uint32(header[16:20]); crc != crc32.ChecksumIEEE(header[0:16]) {
+		return nil, fmt.Errorf("%w: header CRC mismatch", ErrCorruptSnapshot)
+	}
+	numKeys := binary.BigEndian.Uint64(header[8:16])
+	if numKeys > math.MaxInt {
+		return nil, fmt.Errorf("%w: key count %d is too large", ErrCorruptSnapshot, numKeys)
+	}
+
+	// Don't trust the key count for more than a modest initial allocation, the
+	// rest grows as entries are actually read.
+	txn := NewTree[V]().Txn()
+	leaves := make([]*leafNode[V], 0, min(int(numKeys), 1<<20))
+	for block := 0; ; block++ {
+		var hdr [8]byte
+		if _, err := io.ReadFull(br, hdr[:]); err != nil {
+			return nil, snapshotReadErr(fmt.Sprintf("block %d", block), err)
+		}
+		numEntries := binary.BigEndian.Uint32(hdr[0:4])
+		if uint64(numEntries) > numKeys-uint64(len(leaves)) {
+			return nil, fmt.Errorf("%w: block %d has more entries than the header's key count", ErrCorruptSnapshot, block)
+		}
+
+		// Read the payload and CRC into a buffer that grows as the data arrives
+		// so a corrupt length can't force a huge allocation up front.
+		length := int(binary.BigEndian.Uint32(hdr[4:8])) + 4
+		var buf bytes.Buffer
+		buf.Grow(min(length, 2*snapshotBlockSize))
+		if _, err := io.CopyN(&buf, br, int64(length)); err != nil {
+			return nil, snapshotReadErr(fmt.Sprintf("block %d", block), err)
+		}
+		payload := buf.Bytes()
+		crc := binary.BigEndian.Uint32(payload[len(payload)-4:])
+		payload = payload[0 : len(payload)-4]
+		if crc != crc32.ChecksumIEEE(payload) {
+			return nil, fmt.Errorf("%w: block %d CRC mismatch", ErrCorruptSnapshot, block)
+		}
+		if numEntries == 0 {
+			if len(payload) != 0 {
+				return nil, fmt.Errorf("%w: end block has a payload", ErrCorruptSnapshot)
+			}
+			break
+		}
+
+		// Keys are copied out of the payload so that a few surviving keys don't
+		// keep whole blocks alive after the rest are deleted.
+		for i := uint32(0); i < numEntries; i++ {
+			var k, v []byte
+			var ok bool
+			if k, payload, ok = snapshotCutField(payload); !ok {
+				return nil, fmt.Errorf("%w: block %d entry %d has a bad key", ErrCorruptSnapshot, block, i)
+			}
+			if v, payload, ok = snapshotCutField(payload); !ok {
+				return nil, fmt.Errorf("%w: block %d entry %d has a bad value", ErrCorruptSnapshot, block, i)
+			}
+			if len(leaves) > 0 && bytes.Compare(leaves[len(leaves)-1].key, k) >= 0 {
+				return nil, fmt.Errorf("%w: key %q is out of order", ErrCorruptSnapshot, k)
+			}
+			val, err := codec.DecodeValue(v)
+			if err != nil {
+				return nil, fmt.Errorf("%w: failed to decode value for %q: %v", ErrCorruptSnapshot, k, err)
+			}
+			leaves = append(leaves, txn.newLeafNode(snapshotCopy(k), val))
+		}
+		if len(payload) != 0 {
+			return nil, fmt.Errorf("%w: block %d has trailing bytes", ErrCorruptSnapshot, block)
+		}
+	}
+	if uint64(len(leaves)) != numKeys {
+		return nil, fmt.Errorf("%w: header says %d keys but found %d", ErrCorruptSnapshot, numKeys, len(leaves))
+	}
+
+	if len(leaves) > 0 {
+		txn.root = txn.build(leaves, 0)
+	}
+	txn.size = len(leaves)
+	return txn.CommitOnly(), nil
+}
+
+// snapshotCutField splits a uvarint length prefixed field from the front of b.
+func snapshotCutField(b []byte) ([]byte, []byte, bool) {
+	l, n := binary.Uvarint(b)
+	if n <= 0 || l > uint64(len(b)-n) {
+		return nil, nil, false
+	}
+	end := n + int(l)
+	return b[n:end:end], b[end:], true
+}
+
+// snapshotCopy returns a copy of b with no spare capacity.
+func snapshotCopy(b []byte) []byte {
+	c := make([]byte, len(b))
+	copy(c, b)
+	return c
+}
+
+func snapshotReadErr(what string, err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return fmt.Errorf("%w: truncated reading %s", ErrCorruptSnapshot, what)
+	}
+	return err
+}
+
+// build returns a subtree holding leaves, which must be sorted and all share
+// their first depth bytes. Each inner node is created as the type it needs to
+// be for its number of children so nothing has to grow or be copied.
+func (t *Txn[V]) build(leaves []*leafNode[V], depth int) *nodeHeader[V] {
+	if len(leaves) == 1 {
+		return &leaves[0].nodeHeader
+	}
+
+	// Since the leaves are sorted the common prefix of all of them is the
+	// common prefix of the first and last.
+	first, last := leaves[0].key, leaves[len(leaves)-1].key
+	lcp := longestPrefix(first[depth:], last[depth:])
+	depth += lcp
+
+	var innerLeaf *leafNode[V]
+	if len(first) == depth {
+		// The first key ends here so it's the inner leaf.
+		innerLeaf = leaves[0]
+		leaves = leaves[1:]
+	}
+
+	// Count the children first so we can make the right type of node.
+	numChildren := 0
+	for i := 0; i < len(leaves); i++ {
+		if i == 0 || leaves[i].key[depth] != leaves[i-1].key[depth] {
+			numChildren++
+		}
+	}
+	var n *nodeHeader[V]
+	switch {
+	case numChildren <= 4:
+		n = &t.newNode4().nodeHeader
+	case numChildren <= 16:
+		n = &t.newNode16().nodeHeader
+	case numChildren <= 48:
+		n = &t.newNode48().nodeHeader
+	default:
+		n = &t.newNode256().nodeHeader
+	}
+	n.setPrefix(first[depth-lcp : depth])
+	n.setInnerLeaf(innerLeaf)
+
+	for start := 0; start < len(leaves); {
+		c := leaves[start].key[depth]
+		end := start + 1
+		for end < len(leaves) && leaves[end].key[depth] == c {
+			end++
+		}
+		n.addChild(t, c, t.build(leaves[start:end], depth+1))
+		start = end
+	}
+	return n
+}
@@ -0,0 +1,350 @@
+package art
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testUvarintCodec stores int values as uvarints.
+type testUvarintCodec struct{}
+
+func (testUvarintCodec) AppendValue(b []byte, v int) ([]byte, error) {
+	if v < 0 {
+		return nil, errors.New("negative")
+	}
+	return binary.AppendUvarint(b, uint64(v)), nil
+}
+
+func (testUvarintCodec) DecodeValue(b []byte) (int, error) {
+	v, n := binary.Uvarint(b)
+	if n <= 0 || n != len(b) {
+		return 0, errors.New("bad uvarint")
+	}
+	return int(v), nil
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	require := require.New(t)
+
+	tree := NewTree[string]()
+	for _, k := range testKeys() {
+		tree, _, _ = tree.Insert([]byte(k), "v-"+k)
+	}
+
+	var buf bytes.Buffer
+	n, err := tree.WriteTo(&buf)
+	require.NoError(err)
+	require.Equal(int64(buf.Len()), n)
+
+	loaded, err := ReadTree[string](&buf)
+	require.NoError(err)
+	require.NoError(loaded.Validate())
+	require.Equal(tree.Len(), loaded.Len())
+
+	// Building from sorted keys should give the same shape as inserting them.
+	require.Equal(tree.Stats(), loaded.Stats())
+
+	it := tree.Root().Iterator()
+	lit := loaded.Root().Iterator()
+	for {
+		k, v, ok := it.Next()
+		lk, lv, lok := lit.Next()
+		require.Equal(ok, lok)
+		if !ok {
+			break
+		}
+		require.Equal(k, lk)
+		require.Equal(v, lv)
+	}
+
+	// The loaded tree works like any other.
+	loaded, _, _ = loaded.Insert([]byte("foo/new"), "new")
+	loaded, _, _ = loaded.Delete([]byte(testKeys()[0]))
+	require.NoError(loaded.Validate())
+	require.Equal(tree.Len(), loaded.Len())
+	v, ok := loaded.Get([]byte("foo/new"))
+	require.True(ok)
+	require.Equal("new", v)
+}
+
+func TestSnapshotCodecs(t *testing.T) {
+	require := require.New(t)
+
+	t.Run("custom", func(t *testing.T) {
+		tree := NewTree[int]()
+		for i := 0; i < 1000; i++ {
+			tree, _, _ = tree.Insert([]byte(fmt.Sprintf("key/%d", i)), i)
+		}
+		var buf bytes.Buffer
+		_, err := tree.WriteToCodec(&buf, testUvarintCodec{})
+		require.NoError(err)
+
+		loaded, err := ReadTreeCodec[int](&buf, testUvarintCodec{})
+		require.NoError(err)
+		require.NoError(loaded.Validate())
+		require.Equal(1000, loaded.Len())
+		for i := 0; i < 1000; i++ {
+			v, ok := loaded.Get([]byte(fmt.Sprintf("key/%d", i)))
+			require.True(ok)
+			require.Equal(i, v)
+		}
+
+		// Errors from the codec are returned.
+		tree, _, _ = tree.Insert([]byte("key/neg"), -1)
+		_, err = tree.WriteToCodec(&buf, testUvarintCodec{})
+		require.ErrorContains(err, "negative")
+	})
+
+	t.Run("bytes", func(t *testing.T) {
+		tree := NewTree[[]byte]()
+		tree, _, _ = tree.Insert([]byte("a"), []byte("1"))
+		tree, _, _ = tree.Insert([]byte("ab"), []byte{})
+		tree, _, _ = tree.Insert([]byte("b"), []byte("333"))
+
+		var buf bytes.Buffer
+		_, err := tree.WriteTo(&buf)
+		require.NoError(err)
+		loaded, err := ReadTree[[]byte](&buf)
+		require.NoError(err)
+		require.NoError(loaded.Validate())
+
+		v, _ := loaded.Get([]byte("a"))
+		require.Equal([]byte("1"), v)
+		v, _ = loaded.Get([]byte("ab"))
+		require.Empty(v)
+		v, _ = loaded.Get([]byte("b"))
+		require.Equal([]byte("333"), v)
+		// Values don't share capacity with the next entry.
+		require.Equal(len(v), cap(v))
+	})
+
+	t.Run("gob", func(t *testing.T) {
+		tree := New()
+		tree, _, _ = tree.Insert([]byte("int"), 1)
+		tree, _, _ = tree.Insert([]byte("string"), "two")
+		tree, _, _ = tree.Insert([]byte("slice"), []string{"three"})
+
+		var buf bytes.Buffer
+		_, err := tree.WriteTo(&buf)
+		require.NoError(err)
+		loaded, err := ReadTree[interface{}](&buf)
+		require.NoError(err)
+		require.NoError(loaded.Validate())
+		require.Equal(testCollectPairs(tree), testCollectPairs(loaded))
+	})
+}
+
+func TestSnapshotEmpty(t *testing.T) {
+	require := require.New(t)
+
+	var buf bytes.Buffer
+	_, err := NewTree[string]().WriteTo(&buf)
+	require.NoError(err)
+
+	loaded, err := ReadTree[string](&buf)
+	require.NoError(err)
+	require.Equal(0, loaded.Len())
+	require.NoError(loaded.Validate())
+
+	loaded, _, _ = loaded.Insert([]byte("foo"), "bar")
+	require.Equal(1, loaded.Len())
+}
+
+func TestSnapshotLarge(t *testing.T) {
+	require := require.New(t)
+
+	// Enough keys for many blocks and every node type, with long shared
+	// prefixes, keys that are prefixes of others and values longer than a
+	// block.
+	txn := NewTree[string]().Txn()
+	for i := 0; i < 100000; i++ {
+		k := fmt.Sprintf("%03d/common/prefix/longer/than/ten/%d", i%300, i)
+		txn.Insert([]byte(k), k)
+		if i%7 == 0 {
+			txn.Insert([]byte(k[0:4]), "short")
+		}
+	}
+	txn.Insert([]byte("big"), string(bytes.Repeat([]byte("x"), 3*snapshotBlockSize)))
+	tree := txn.Commit()
+
+	var buf bytes.Buffer
+	_, err := tree.WriteTo(&buf)
+	require.NoError(err)
+
+	loaded, err := ReadTree[string](&buf)
+	require.NoError(err)
+	require.NoError(loaded.Validate())
+	require.Equal(tree.Stats(), loaded.Stats())
+	require.Equal(testCollectPairs(testAnyTree(tree)), testCollectPairs(testAnyTree(loaded)))
+}
+
+func TestSnapshotRetention(t *testing.T) {
+	require := require.New(t)
+
+	// A few MB of snapshot, so dozens of blocks.
+	txn := NewTree[[]byte]().Txn()
+	val := bytes.Repeat([]byte("v"), 100)
+	for i := 0; i < 50000; i++ {
+		txn.Insert([]byte(fmt.Sprintf("key/%06d", i)), val)
+	}
+	var buf bytes.Buffer
+	_, err := txn.Commit().WriteTo(&buf)
+	require.NoError(err)
+	data := buf.Bytes()
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	// Keep one key in every thousand, which leaves one in most blocks.
+	loaded, err := ReadTree[[]byte](bytes.NewReader(data))
+	require.NoError(err)
+	txn = loaded.Txn()
+	for i := 0; i < 50000; i++ {
+		if i%1000 != 0 {
+			txn.Delete([]byte(fmt.Sprintf("key/%06d", i)))
+		}
+	}
+	pruned := txn.Commit()
+	loaded, txn = nil, nil
+
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+	require.Equal(50, pruned.Len())
+	// The surviving keys and values don't keep their blocks alive.
+	require.Less(int64(after.HeapAlloc)-int64(before.HeapAlloc), int64(1<<20))
+	runtime.KeepAlive(data)
+	runtime.KeepAlive(pruned)
+}
+
+// testAnyTree copies tree into a Tree[any] for helpers that need one.
+func testAnyTree(tree *Tree[string]) *Tree[any] {
+	txn := New().Txn()
+	tree.Root().Walk(func(k []byte, v string) bool {
+		txn.Insert(k, v)
+		return false
+	})
+	return txn.Commit()
+}
+
+func TestSnapshotCorrupt(t *testing.T) {
+	tree := NewTree[string]()
+	for _, k := range testKeys() {
+		tree, _, _ = tree.Insert([]byte(k), k)
+	}
+	var buf bytes.Buffer
+	_, err := tree.WriteTo(&buf)
+	require.NoError(t, err)
+	good := buf.Bytes()
+
+	// Offsets into the first block.
+	blockHdr := snapshotHeaderLen
+	payload := blockHdr + 8
+
+	tests := []struct {
+		name    string
+		corrupt func(b []byte) []byte
+		wantErr string
+	}{
+		{
+			name:    "bad magic",
+			corrupt: func(b []byte) []byte { b[0] = 'x'; return b },
+			wantErr: "bad magic",
+		},
+		{
+			name:    "bad version",
+			corrupt: func(b []byte) []byte { binary.BigEndian.PutUint16(b[4:6], 99); return b },
+			wantErr: "unsupported version 99",
+		},
+		{
+			name:    "header CRC",
+			corrupt: func(b []byte) []byte { b[10]++; return b },
+			wantErr: "header CRC mismatch",
+		},
+		{
+			name:    "payload CRC",
+			corrupt: func(b []byte) []byte { b[payload+3] ^= 0xff; return b },
+			wantErr: "block 0 CRC mismatch",
+		},
+		{
+			name:    "truncated header",
+			corrupt: func(b []byte) []byte { return b[0:10] },
+			wantErr: "truncated reading header",
+		},
+		{
+			name:    "truncated block",
+			corrupt: func(b []byte) []byte { return b[0 : payload+10] },
+			wantErr: "truncated reading block 0",
+		},
+		{
+			name:    "missing end block",
+			corrupt: func(b []byte) []byte { return b[0 : len(b)-12] },
+			wantErr: "truncated reading block 1",
+		},
+		{
+			name: "wrong entry count",
+			corrupt: func(b []byte) []byte {
+				binary.BigEndian.PutUint32(b[blockHdr:], binary.BigEndian.Uint32(b[blockHdr:])+1)
+				return b
+			},
+			wantErr: "block 0 has more entries than the header's key count",
+		},
+		{
+			name: "wrong key count",
+			corrupt: func(b []byte) []byte {
+				binary.BigEndian.PutUint64(b[8:16], uint64(tree.Len()+3))
+				binary.BigEndian.PutUint32(b[16:20], crc32.ChecksumIEEE(b[0:16]))
+				return b
+			},
+			wantErr: fmt.Sprintf("header says %d keys but found %d", tree.Len()+3, tree.Len()),
+		},
+		{
+			name: "huge key count",
+			corrupt: func(b []byte) []byte {
+				binary.BigEndian.PutUint64(b[8:16], 1<<63)
+				binary.BigEndian.PutUint32(b[16:20], crc32.ChecksumIEEE(b[0:16]))
+				return b
+			},
+			wantErr: "key count 9223372036854775808 is too large",
+		},
+		{
+			name: "huge block length",
+			corrupt: func(b []byte) []byte {
+				binary.BigEndian.PutUint32(b[blockHdr+4:], math.MaxUint32)
+				return b
+			},
+			wantErr: "truncated reading block 0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := tt.corrupt(append([]byte(nil), good...))
+			_, err := ReadTree[string](bytes.NewReader(b))
+			require.ErrorIs(t, err, ErrCorruptSnapshot)
+			require.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+
+	// A huge block length must not be allocated up front.
+	b := append([]byte(nil), good...)
+	binary.BigEndian.PutUint32(b[blockHdr+4:], math.MaxUint32)
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	_, err = ReadTree[string](bytes.NewReader(b))
+	runtime.ReadMemStats(&after)
+	require.ErrorIs(t, err, ErrCorruptSnapshot)
+	require.Less(t, after.TotalAlloc-before.TotalAlloc, uint64(16<<20))
+
+	// The untouched snapshot still loads.
+	_, err = ReadTree[string](bytes.NewReader(good))
+	require.NoError(t, err)
+}
@@ -0,0 +1,112 @@
+package art
+
+import (
+	"unsafe"
+)
+
+// Stats describes the shape and approximate size of a tree or subtree.
+type Stats struct {
+	// Leaves is the number of leaves, including inner leaves, which is the
+	// number of keys.
+	Leaves int
+
+	// Node4, Node16, Node48 and Node256 are the number of inner nodes of each
+	// type.
+	Node4   int
+	Node16  int
+	Node48  int
+	Node256 int
+
+	// InnerLeaves is the number of leaves stored in inner nodes rather than as
+	// children because their key is a prefix of other keys.
+	InnerLeaves int
+
+	// LeafDepths is a histogram of leaf depth. LeafDepths[d] is the number of
+	// leaves with d inner nodes above them, an inner leaf counts as below the
+	// node that holds it.
+	LeafDepths []int
+
+	// AvgFanout is the mean number of children of the inner nodes.
+	AvgFanout float64
+
+	// PrefixLens is a histogram of the full prefix lengths of the inner nodes.
+	// It's a map since prefixes can be long but there are usually few distinct
+	// lengths.
+	PrefixLens map[int]int
+
+	// Bytes is an estimate of the memory used by the nodes and keys. It's based
+	// on the size of each node struct so it doesn't include any memory values
+	// refer to, or allocator overhead.
+	Bytes int
+}
+
+// Stats walks the whole tree and returns its Stats.
+func (t *Tree[V]) Stats() Stats {
+	return t.Root().Stats()
+}
+
+// Stats walks the subtree rooted at n and returns its Stats.
+func (n *APINode[V]) Stats() Stats {
+	s := Stats{
+		PrefixLens: make(map[int]int),
+	}
+	if n.h == nil {
+		return s
+	}
+	numChildren := 0
+	numInner := statsNode(&s, n.h, 0, &numChildren)
+	if numInner > 0 {
+		s.AvgFanout = float64(numChildren) / float64(numInner)
+	}
+	return s
+}
+
+// statsNode adds the subtree n at the given depth to s and the number of
+// children of its inner nodes to numChildren. It returns the number of inner
+// nodes in the subtree.
+func statsNode[V any](s *Stats, n *nodeHeader[V], depth int, numChildren *int) int {
+	if n.typ == typLeaf {
+		statsLeaf(s, n.leafNode(), depth)
+		return 0
+	}
+
+	switch n.typ {
+	case typNode4:
+		s.Node4++
+		s.Bytes += int(unsafe.Sizeof(node4[V]{}))
+	case typNode16:
+		s.Node16++
+		s.Bytes += int(unsafe.Sizeof(node16[V]{}))
+	case typNode48:
+		s.Node48++
+		s.Bytes += int(unsafe.Sizeof(node48[V]{}))
+	case typNode256:
+		s.Node256++
+		s.Bytes += int(unsafe.Sizeof(node256[V]{}))
+	}
+	pLen, _ := n.prefixFields()
+	s.PrefixLens[int(*pLen)]++
+
+	if leaf := n.innerLeaf(); leaf != nil {
+		s.InnerLeaves++
+		statsLeaf(s, leaf, depth+1)
+	}
+
+	numInner := 1
+	*numChildren += n.numChildren()
+	for _, child := range n.childSlice() {
+		if child != nil {
+			numInner += statsNode(s, child, depth+1, numChildren)
+		}
+	}
+	return numInner
+}
+
+func statsLeaf[V any](s *Stats, leaf *leafNode[V], depth int) {
+	s.Leaves++
+	s.Bytes += int(unsafe.Sizeof(*leaf)) + len(leaf.key)
+	for len(s.LeafDepths) <= depth {
+		s.LeafDepths = append(s.LeafDepths, 0)
+	}
+	s.LeafDepths[depth]++
+}
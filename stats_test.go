@@ -0,0 +1,77 @@
+package art
+
+import (
+	"testing"
+	"unsafe"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStats(t *testing.T) {
+	require := require.New(t)
+
+	tree := NewTree[int]()
+	for i, k := range []string{"a", "ab", "ac"} {
+		tree, _, _ = tree.Insert([]byte(k), i)
+	}
+
+	// A node4 with prefix "a", the inner leaf "a" and two children.
+	require.Equal(Stats{
+		Leaves:      3,
+		Node4:       1,
+		InnerLeaves: 1,
+		LeafDepths:  []int{0, 3},
+		AvgFanout:   2,
+		PrefixLens:  map[int]int{1: 1},
+		Bytes: int(unsafe.Sizeof(node4[int]{})) +
+			3*int(unsafe.Sizeof(leafNode[int]{})) + len("a") + len("ab") + len("ac"),
+	}, tree.Stats())
+
+	// A single leaf
+	tree = NewTree[int]()
+	tree, _, _ = tree.Insert([]byte("foo"), 1)
+	require.Equal(Stats{
+		Leaves:     1,
+		LeafDepths: []int{1},
+		PrefixLens: map[int]int{},
+		Bytes:      int(unsafe.Sizeof(leafNode[int]{})) + 3,
+	}, tree.Stats())
+
+	require.Equal(Stats{PrefixLens: map[int]int{}}, NewTree[int]().Stats())
+}
+
+func TestStatsTestKeys(t *testing.T) {
+	require := require.New(t)
+
+	tree := testBuildTree(testKeys(), 1)
+	s := tree.Stats()
+
+	require.Equal(tree.Len(), s.Leaves)
+	depthTotal := 0
+	for _, n := range s.LeafDepths {
+		depthTotal += n
+	}
+	require.Equal(s.Leaves, depthTotal)
+
+	// "wide/" has a child for every byte and "mid/" has 20.
+	require.Equal(1, s.Node256)
+	require.Equal(1, s.Node48)
+	numInner := s.Node4 + s.Node16 + s.Node48 + s.Node256
+	prefixTotal := 0
+	for _, n := range s.PrefixLens {
+		prefixTotal += n
+	}
+	require.Equal(numInner, prefixTotal)
+	require.Greater(s.PrefixLens[len("very/long/shared/prefix/")], 0)
+
+	// Every key is either an inner leaf or a child so the fanout covers all the
+	// other leaves and inner nodes except the root.
+	require.InDelta(float64(s.Leaves-s.InnerLeaves+numInner-1)/float64(numInner), s.AvgFanout, 1e-9)
+
+	// A subtree has a subset of the nodes.
+	sub := &APINode[any]{h: tree.root.seekPrefix([]byte("wide/"))}
+	subStats := sub.Stats()
+	require.Equal(256, subStats.Leaves)
+	require.Equal(1, subStats.Node256)
+	require.Equal([]int{0, 256}, subStats.LeafDepths)
+}
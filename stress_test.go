@@ -0,0 +1,207 @@
+package art
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testChecksum hashes every key and value in the tree in both directions. Any
+// change to a tree after it's committed changes its checksum.
+func testChecksum(tree *Tree[int]) uint64 {
+	h := fnv.New64a()
+	it := tree.Root().Iterator()
+	n := 0
+	for k, v, ok := it.Next(); ok; k, v, ok = it.Next() {
+		fmt.Fprintf(h, "%q=%d,", k, v)
+		n++
+	}
+	ri := tree.Root().ReverseIterator()
+	for k, v, ok := ri.Previous(); ok; k, v, ok = ri.Previous() {
+		fmt.Fprintf(h, "%q=%d,", k, v)
+		n--
+	}
+	fmt.Fprintf(h, "len=%d,%d", tree.Len(), n)
+	return h.Sum64()
+}
+
+// testHeldSnapshot is a tree a reader holds on to along with what it should
+// contain.
+type testHeldSnapshot struct {
+	tree     *Tree[int]
+	checksum uint64
+	keys     [][]byte
+	values   []int
+}
+
+func testHoldSnapshot(tree *Tree[int]) testHeldSnapshot {
+	s := testHeldSnapshot{tree: tree, checksum: testChecksum(tree)}
+	it := tree.Root().Iterator()
+	for k, v, ok := it.Next(); ok; k, v, ok = it.Next() {
+		s.keys = append(s.keys, k)
+		s.values = append(s.values, v)
+	}
+	return s
+}
+
+func (s testHeldSnapshot) verify() error {
+	if got := testChecksum(s.tree); got != s.checksum {
+		return fmt.Errorf("checksum changed from %x to %x", s.checksum, got)
+	}
+	for i, k := range s.keys {
+		v, ok := s.tree.Get(k)
+		if !ok || v != s.values[i] {
+			return fmt.Errorf("get %q returned %d %v, expected %d", k, v, ok, s.values[i])
+		}
+	}
+	return nil
+}
+
+// TestStressSnapshotIsolation commits continuously from one goroutine while
+// readers hold on to older trees and keep checking they haven't changed. Run
+// it with -race to also catch writes to shared nodes that happen not to change
+// the contents.
+func TestStressSnapshotIsolation(t *testing.T) {
+	duration := 2 * time.Second
+	if testing.Short() {
+		duration = 200 * time.Millisecond
+	}
+	const numReaders = 8
+	const numHeld = 4
+
+	keys := testKeys()
+	start := NewTree[int]().Txn()
+	for i, k := range keys {
+		start.Insert([]byte(k), i)
+	}
+	var current atomic.Value
+	current.Store(start.Commit())
+
+	done := make(chan struct{})
+	errCh := make(chan error, numReaders+1)
+	var wg sync.WaitGroup
+
+	// Writer
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		r := rand.New(rand.NewSource(1))
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			tree := current.Load().(*Tree[int])
+			txn := tree.Txn()
+			txn.TrackMutate(true)
+			txn.BatchMerge(i%3 == 0)
+			for j := 0; j < r.Intn(20)+1; j++ {
+				k := []byte(keys[r.Intn(len(keys))])
+				switch op := r.Intn(10); {
+				case op < 6:
+					txn.Insert(k, i)
+				case op < 9:
+					txn.Delete(k)
+				default:
+					txn.DeletePrefix(k[0:r.Intn(len(k)+1)])
+				}
+			}
+			tree = txn.Commit()
+			if err := tree.Validate(); err != nil {
+				errCh <- err
+				return
+			}
+			current.Store(tree)
+		}
+	}()
+
+	// Readers
+	for i := 0; i < numReaders; i++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(seed))
+			var held []testHeldSnapshot
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				// Swap one of the held trees for the latest now and then.
+				s := testHoldSnapshot(current.Load().(*Tree[int]))
+				if len(held) < numHeld {
+					held = append(held, s)
+				} else if r.Intn(4) == 0 {
+					held[r.Intn(numHeld)] = s
+				}
+				for _, s := range held {
+					if err := s.verify(); err != nil {
+						errCh <- err
+						return
+					}
+				}
+			}
+		}(int64(i))
+	}
+
+	select {
+	case err := <-errCh:
+		close(done)
+		wg.Wait()
+		t.Fatal(err)
+	case <-time.After(duration):
+		close(done)
+		wg.Wait()
+	}
+	select {
+	case err := <-errCh:
+		t.Fatal(err)
+	default:
+	}
+}
+
+// TestSnapshotIsolationInPlaceFastPaths checks writes that the node types can
+// do in place when a node has room, or enough children to not shrink, are
+// never applied to nodes in a committed tree.
+func TestSnapshotIsolationInPlaceFastPaths(t *testing.T) {
+	// Enough children under "x" for each node type to have room to grow and to
+	// lose one without shrinking.
+	for _, n := range []int{3, 6, 20, 50} {
+		t.Run(fmt.Sprintf("children-%d", n), func(t *testing.T) {
+			require := require.New(t)
+
+			tree := NewTree[int]()
+			for i := 0; i < n; i++ {
+				tree, _, _ = tree.Insert([]byte{'x', byte(i)}, i)
+			}
+			snap := testHoldSnapshot(tree)
+
+			// Add a child, replace one, add an inner leaf and remove a child, all
+			// from the same snapshot.
+			writes := []func(txn *Txn[int]){
+				func(txn *Txn[int]) { txn.Insert([]byte{'x', 200}, 200) },
+				func(txn *Txn[int]) { txn.Insert([]byte{'x', 0}, 100) },
+				func(txn *Txn[int]) { txn.Insert([]byte{'x'}, 100) },
+				func(txn *Txn[int]) { txn.Delete([]byte{'x', 1}) },
+				func(txn *Txn[int]) { txn.DeletePrefix([]byte{'x', 2}) },
+			}
+			for _, write := range writes {
+				for _, batch := range []bool{false, true} {
+					txn := snap.tree.Txn()
+					txn.BatchMerge(batch)
+					write(txn)
+					require.NoError(txn.Commit().Validate())
+					require.NoError(snap.verify())
+				}
+			}
+		})
+	}
+}
@@ -3,37 +3,54 @@ package art
 // Tree is an immutable radix tree. Write transactions can be performed that
 // will return a new tree leaving old nodes untouched. This makes it safe for
 // concurrent readers without locks.
-type Tree struct {
-	root  *nodeHeader
+type Tree[V any] struct {
+	root  *nodeHeader[V]
 	maxID uint64
 	size  int
+
+	// watches is shared by every tree committed from the same New tree.
+	watches *WatchRegistry
+
+	// version holds the state watches need for this tree.
+	version *treeVersion
+}
+
+// New returns an empty Tree that holds values of any type. It's the untyped
+// API for compatibility with iradix, use NewTree to store a specific type of
+// value without boxing.
+func New() *Tree[interface{}] {
+	return NewTree[interface{}]()
 }
 
-// New returns an empty Tree
-func New() *Tree {
-	return &Tree{}
+// NewTree returns an empty Tree that holds values of type V.
+func NewTree[V any]() *Tree[V] {
+	return &Tree[V]{
+		watches: newWatchRegistry(),
+		version: &treeVersion{},
+	}
 }
 
 // Len is used to return the number of elements in the tree
-func (t *Tree) Len() int {
+func (t *Tree[V]) Len() int {
 	return t.size
 }
 
 // Txn starts a new transaction that can be used to mutate the tree
-func (t *Tree) Txn() *Txn {
-	txn := &Txn{
+func (t *Tree[V]) Txn() *Txn[V] {
+	txn := &Txn[V]{
 		maxRootID: t.maxID,
 		maxSnapID: t.maxID,
 		root:      t.root,
 		snap:      t.root,
 		size:      t.size,
+		tree:      t,
 	}
 	return txn
 }
 
 // Insert is used to add or update a given key. The return provides
 // the new tree, previous value and a bool indicating if any was set.
-func (t *Tree) Insert(k []byte, v interface{}) (*Tree, interface{}, bool) {
+func (t *Tree[V]) Insert(k []byte, v V) (*Tree[V], V, bool) {
 	txn := t.Txn()
 	old, ok := txn.Insert(k, v)
 	return txn.Commit(), old, ok
@@ -41,7 +58,7 @@ func (t *Tree) Insert(k []byte, v interface{}) (*Tree, interface{}, bool) {
 
 // Delete is used to delete a given key. Returns the new tree,
 // old value if any, and a bool indicating if the key was set.
-func (t *Tree) Delete(k []byte) (*Tree, interface{}, bool) {
+func (t *Tree[V]) Delete(k []byte) (*Tree[V], V, bool) {
 	txn := t.Txn()
 	old, ok := txn.Delete(k)
 	return txn.Commit(), old, ok
@@ -49,22 +66,69 @@ func (t *Tree) Delete(k []byte) (*Tree, interface{}, bool) {
 
 // DeletePrefix is used to delete all nodes starting with a given prefix. Returns the new tree,
 // and a bool indicating if the prefix matched any nodes
-func (t *Tree) DeletePrefix(k []byte) (*Tree, bool) {
+func (t *Tree[V]) DeletePrefix(k []byte) (*Tree[V], bool) {
 	txn := t.Txn()
 	ok := txn.DeletePrefix(k)
 	return txn.Commit(), ok
 }
 
+// GetWatch is used to lookup a specific key, returning the watch channel,
+// value and if it was found.
+func (t *Tree[V]) GetWatch(k []byte) (<-chan struct{}, V, bool) {
+	return t.Root().GetWatch(k)
+}
+
+// WatchPrefix returns a channel that is closed when any key starting with
+// prefix is inserted, updated or deleted by a later commit.
+func (t *Tree[V]) WatchPrefix(prefix []byte) <-chan struct{} {
+	return t.Root().WatchPrefix(prefix)
+}
+
+// WatchRegistry returns the registry of watchers shared by this tree and every
+// other tree committed from the same original New tree.
+func (t *Tree[V]) WatchRegistry() *WatchRegistry {
+	return t.watches
+}
+
 // Root returns the root node of the tree which can be used for richer
 // query operations.
-func (t *Tree) Root() *APINode {
-	return &APINode{
-		h: t.root,
+func (t *Tree[V]) Root() *APINode[V] {
+	return &APINode[V]{
+		h:    t.root,
+		tree: t,
 	}
 }
 
 // Get is used to lookup a specific key, returning
 // the value and if it was found
-func (t *Tree) Get(k []byte) (interface{}, bool) {
-	return nil, false
+func (t *Tree[V]) Get(k []byte) (V, bool) {
+	return t.Root().Get(k)
+}
+
+// LongestPrefix is like Get, but instead of an exact match, it will return the
+// longest key that is a prefix of k along with its value.
+func (t *Tree[V]) LongestPrefix(k []byte) ([]byte, V, bool) {
+	return t.Root().LongestPrefix(k)
+}
+
+// Minimum is used to return the minimum key and value in the tree.
+func (t *Tree[V]) Minimum() ([]byte, V, bool) {
+	return t.Root().Minimum()
+}
+
+// Maximum is used to return the maximum key and value in the tree.
+func (t *Tree[V]) Maximum() ([]byte, V, bool) {
+	return t.Root().Maximum()
+}
+
+// MinimumPrefix is used to return the minimum key and value that start with
+// prefix.
+func (t *Tree[V]) MinimumPrefix(prefix []byte) ([]byte, V, bool) {
+	return t.Root().MinimumPrefix(prefix)
+}
+
+// MaximumPrefix is used to return the maximum key and value that start with
+// prefix.
+func (t *Tree[V]) MaximumPrefix(prefix []byte) ([]byte, V, bool) {
+	return t.Root().MaximumPrefix(prefix)
 }
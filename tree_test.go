@@ -0,0 +1,389 @@
+package art
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// testLongPrefix is longer than maxPrefixLen so keys that share it exercise the
+// optimistic prefix checks.
+const testLongPrefix = "this/is/a/very/long/shared/prefix/"
+
+// testKeys returns a set of keys that includes keys which are prefixes of each
+// other, keys sharing prefixes longer than maxPrefixLen and enough keys with
+// the same parent to grow every node type.
+func testKeys() []string {
+	keys := []string{
+		"",
+		"a",
+		"aa",
+		"aaa",
+		"ab",
+		"foo",
+		"foo/bar",
+		"foo/bar/baz",
+		"foo/baz",
+		"foobar",
+		testLongPrefix,
+		testLongPrefix + "a",
+		testLongPrefix + "b",
+		testLongPrefix + "ba",
+		testLongPrefix + "bb/and/then/another/long/bit",
+		testLongPrefix + "bb/and/then/another/long/bit/more",
+		testLongPrefix + "bb/and/then/another/long/bot",
+	}
+	for _, c := range allTheBytes {
+		keys = append(keys, "wide/"+string([]byte{c}))
+	}
+	for _, c := range allTheBytes[0:20] {
+		keys = append(keys, "mid/"+string([]byte{c})+"/x")
+	}
+	return keys
+}
+
+func TestTreeGet(t *testing.T) {
+	require := require.New(t)
+
+	keys := testKeys()
+
+	// Insert in a few different orders since the shape of the tree can depend on
+	// it.
+	for seed := int64(0); seed < 5; seed++ {
+		t.Run(fmt.Sprintf("seed-%d", seed), func(t *testing.T) {
+			r := rand.New(rand.NewSource(seed))
+			r.Shuffle(len(keys), func(i, j int) { keys[i], keys[j] = keys[j], keys[i] })
+
+			tree := New()
+			for i, k := range keys {
+				var ok bool
+				tree, _, ok = tree.Insert([]byte(k), k)
+				require.False(ok, "key %q already existed", k)
+				require.NoError(tree.Validate())
+
+				// Everything inserted so far should be found
+				for _, k2 := range keys[0 : i+1] {
+					v, ok := tree.Get([]byte(k2))
+					require.True(ok, "missing %q after inserting %q", k2, k)
+					require.Equal(k2, v)
+				}
+			}
+
+			// Keys that were never inserted should not be found
+			for _, k := range []string{"b", "fo", "foo/", "aaaa", "wide/", "mid/Z",
+				"mid/Z/", testLongPrefix[0:15], testLongPrefix + "c",
+				testLongPrefix + "bb/and/then/another/long/b",
+				"this/is/a/very/long/shared/prefiX/a"} {
+				_, ok := tree.Get([]byte(k))
+				require.False(ok, "found %q which was never inserted", k)
+			}
+		})
+	}
+}
+
+func TestTreeGetReplace(t *testing.T) {
+	require := require.New(t)
+
+	tree := New()
+	for _, k := range testKeys() {
+		tree, _, _ = tree.Insert([]byte(k), 1)
+	}
+	old := tree
+
+	for _, k := range testKeys() {
+		var prev interface{}
+		var ok bool
+		tree, prev, ok = tree.Insert([]byte(k), 2)
+		require.True(ok)
+		require.Equal(1, prev)
+	}
+
+	for _, k := range testKeys() {
+		v, ok := tree.Get([]byte(k))
+		require.True(ok)
+		require.Equal(2, v)
+
+		// The old snapshot must be unaffected
+		v, ok = old.Get([]byte(k))
+		require.True(ok)
+		require.Equal(1, v)
+	}
+}
+
+func TestTreeGetEmpty(t *testing.T) {
+	tree := New()
+	_, ok := tree.Get([]byte("foo"))
+	require.False(t, ok)
+	_, ok = tree.Get(nil)
+	require.False(t, ok)
+}
+
+func TestTxnGet(t *testing.T) {
+	require := require.New(t)
+
+	txn := New().Txn()
+	for _, k := range testKeys() {
+		txn.Insert([]byte(k), k)
+		v, ok := txn.Get([]byte(k))
+		require.True(ok)
+		require.Equal(k, v)
+	}
+	tree := txn.Commit()
+	for _, k := range testKeys() {
+		v, ok := tree.Root().Get([]byte(k))
+		require.True(ok)
+		require.Equal(k, v)
+	}
+
+	// Splitting a prefix of a node created in the same txn must not lose the
+	// keys below it.
+	txn = New().Txn()
+	for _, k := range []string{"abcdef1", "abcdef2", "aZ"} {
+		txn.Insert([]byte(k), k)
+	}
+	for _, k := range []string{"abcdef1", "abcdef2", "aZ"} {
+		v, ok := txn.Get([]byte(k))
+		require.True(ok, "missing %q", k)
+		require.Equal(k, v)
+	}
+}
+
+// testAssertCompressed fails if any node4 in the tree has a single child and no
+// inner leaf, or any inner node has no children, since delete should always
+// collapse those.
+func testAssertCompressed(t *testing.T, n *nodeHeader[any]) {
+	t.Helper()
+	if n == nil || n.typ == typLeaf {
+		return
+	}
+	nChildren := n.numChildren()
+	require.NotZero(t, nChildren, "inner node %d has no children", n.id)
+	if nChildren == 1 {
+		require.NotNil(t, n.innerLeaf(), "node %d has one child and no leaf", n.id)
+	}
+	for c := 0; c < 256; c++ {
+		testAssertCompressed(t, n.findChild(byte(c)))
+	}
+}
+
+func TestTreeDelete(t *testing.T) {
+	require := require.New(t)
+
+	keys := testKeys()
+
+	for seed := int64(0); seed < 5; seed++ {
+		t.Run(fmt.Sprintf("seed-%d", seed), func(t *testing.T) {
+			r := rand.New(rand.NewSource(seed))
+
+			tree := New()
+			for _, k := range keys {
+				tree, _, _ = tree.Insert([]byte(k), k)
+			}
+			full := tree
+
+			r.Shuffle(len(keys), func(i, j int) { keys[i], keys[j] = keys[j], keys[i] })
+			for i, k := range keys {
+				var old interface{}
+				var ok bool
+				tree, old, ok = tree.Delete([]byte(k))
+				require.True(ok, "failed to delete %q", k)
+				require.Equal(k, old)
+
+				// Deleting again is a no-op
+				_, _, ok = tree.Delete([]byte(k))
+				require.False(ok)
+
+				for _, k2 := range keys[0 : i+1] {
+					_, ok := tree.Get([]byte(k2))
+					require.False(ok, "found %q after deleting it", k2)
+				}
+				for _, k2 := range keys[i+1:] {
+					v, ok := tree.Get([]byte(k2))
+					require.True(ok, "missing %q after deleting %q", k2, k)
+					require.Equal(k2, v)
+				}
+				testAssertCompressed(t, tree.root)
+				require.NoError(tree.Validate())
+			}
+			require.Nil(tree.root)
+
+			// Old snapshot must still have everything
+			for _, k := range keys {
+				v, ok := full.Get([]byte(k))
+				require.True(ok)
+				require.Equal(k, v)
+			}
+		})
+	}
+}
+
+func TestTxnDeleteTracksMutations(t *testing.T) {
+	require := require.New(t)
+
+	tree := New()
+	for _, k := range []string{"foo", "foobar", "foobaz", "zip"} {
+		tree, _, _ = tree.Insert([]byte(k), k)
+	}
+
+	leaf := tree.root.findLeaf([]byte("foobar"))
+	require.NotNil(leaf)
+
+	txn := tree.Txn()
+	_, ok := txn.Delete([]byte("foobar"))
+	require.True(ok)
+
+	// The root and the deleted leaf must have been recorded
+	require.Contains(txn.mutateSet, tree.root.id)
+	require.Contains(txn.mutateSet, leaf.id)
+
+	// A miss must not record anything
+	txn = tree.Txn()
+	_, ok = txn.Delete([]byte("foob"))
+	require.False(ok)
+	require.Empty(txn.mutateSet)
+}
+
+func TestTreeDeletePrefix(t *testing.T) {
+	keys := testKeys()
+
+	prefixes := []string{
+		"",
+		"a",
+		"aa",
+		"aaaa",
+		"b",
+		"fo",
+		"foo",
+		"foo/",
+		"foo/bar",
+		"foob",
+		"wide/",
+		"wide/a",
+		"mid/",
+		"this/is/a/very",
+		"this/is/a/very/long/shared/prefix",
+		testLongPrefix,
+		testLongPrefix + "b",
+		testLongPrefix + "bb/and/then/another/long/b",
+		testLongPrefix + "bb/and/then/another/long/bit/",
+		"this/is/a/very/long/shared/prefiX",
+	}
+
+	tree := New()
+	for _, k := range keys {
+		tree, _, _ = tree.Insert([]byte(k), k)
+	}
+
+	for _, p := range prefixes {
+		t.Run(p, func(t *testing.T) {
+			require := require.New(t)
+
+			txn := tree.Txn()
+			ok := txn.DeletePrefix([]byte(p))
+			got := txn.Commit()
+
+			var wantDeleted []string
+			for _, k := range keys {
+				if len(k) >= len(p) && k[0:len(p)] == p {
+					wantDeleted = append(wantDeleted, k)
+					leaf := tree.root.findLeaf([]byte(k))
+					require.Contains(txn.mutateSet, leaf.id)
+					_, found := got.Get([]byte(k))
+					require.False(found, "found %q after deleting prefix", k)
+				} else {
+					v, found := got.Get([]byte(k))
+					require.True(found, "missing %q after deleting prefix", k)
+					require.Equal(k, v)
+				}
+			}
+			require.Equal(len(wantDeleted) > 0, ok)
+			testAssertCompressed(t, got.root)
+
+			// Original is untouched
+			for _, k := range keys {
+				v, found := tree.Get([]byte(k))
+				require.True(found)
+				require.Equal(k, v)
+			}
+		})
+	}
+}
+
+func TestTreeLen(t *testing.T) {
+	keys := testKeys()
+
+	for seed := int64(0); seed < 10; seed++ {
+		t.Run(fmt.Sprintf("seed-%d", seed), func(t *testing.T) {
+			require := require.New(t)
+			r := rand.New(rand.NewSource(seed))
+
+			tree := New()
+			want := make(map[string]bool)
+			for i := 0; i < 500; i++ {
+				txn := tree.Txn()
+				// Do a few ops in each transaction so we check Len mid-transaction too.
+				for j := 0; j < r.Intn(4)+1; j++ {
+					k := keys[r.Intn(len(keys))]
+					switch op := r.Intn(10); {
+					case op < 6:
+						txn.Insert([]byte(k), k)
+						want[k] = true
+					case op < 9:
+						txn.Delete([]byte(k))
+						delete(want, k)
+					default:
+						// Use a short prefix of the key so it tends to delete a few.
+						p := k[0:r.Intn(len(k)+1)]
+						txn.DeletePrefix([]byte(p))
+						for k2 := range want {
+							if len(k2) >= len(p) && k2[0:len(p)] == p {
+								delete(want, k2)
+							}
+						}
+					}
+					require.Equal(len(want), txn.Len(), "after op on %q", k)
+				}
+				tree = txn.Commit()
+				require.Equal(len(want), tree.Len())
+			}
+		})
+	}
+}
+
+func TestTypedTree(t *testing.T) {
+	require := require.New(t)
+
+	type record struct {
+		name  string
+		count int
+	}
+
+	tree := NewTree[record]()
+	for i, k := range testKeys() {
+		tree, _, _ = tree.Insert([]byte(k), record{name: k, count: i})
+	}
+	require.Equal(len(testKeys()), tree.Len())
+
+	// Values come back typed with no assertion needed
+	for i, k := range testKeys() {
+		v, ok := tree.Get([]byte(k))
+		require.True(ok)
+		require.Equal(record{name: k, count: i}, v)
+	}
+
+	// Misses return the zero value
+	v, ok := tree.Get([]byte("missing"))
+	require.False(ok)
+	require.Equal(record{}, v)
+
+	tree, old, ok := tree.Delete([]byte("foo"))
+	require.True(ok)
+	require.Equal("foo", old.name)
+
+	it := tree.Root().Iterator()
+	for k, v, ok := it.Next(); ok; k, v, ok = it.Next() {
+		require.Equal(string(k), v.name)
+	}
+}
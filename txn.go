@@ -8,42 +8,74 @@ import (
 // Txn is a transaction on the tree. This transaction is applied
 // atomically and returns a new tree when committed. A transaction
 // is not thread safe, and should only be used by a single goroutine.
-type Txn struct {
+type Txn[V any] struct {
 	maxRootID uint64
-	root      *nodeHeader
+	root      *nodeHeader[V]
 	maxSnapID uint64
-	snap      *nodeHeader
+	snap      *nodeHeader[V]
 	size      int
 
+	// tree is the snapshot the transaction was started from and committed is
+	// the tree produced by CommitOnly.
+	tree      *Tree[V]
+	committed *Tree[V]
+
 	// trackMutate enables chan-based mutation watching for this transaction.
 	trackMutate bool
 
-	mutateSet map[uint64]struct{}
+	// mutateSet holds the IDs of every node in the snapshot that is no longer in
+	// the tree being built, along with the flag Notify sets on each.
+	mutateSet map[uint64]*bool
+
+	// trackChanges enables recording of every key written in changes.
+	trackChanges bool
+	changes      map[string]*Change[V]
+
+	// batch enables buffering of writes in updates and deletes until they are
+	// merged into root. See BatchMerge.
+	batch   bool
+	updates *nodeHeader[V]
+	deletes map[string]struct{}
 }
 
 // TrackMutate can be used to toggle if mutations are tracked using channels. If
 // this is enabled then notifications will be issued for affected internal nodes
 // and leaves when the transaction is committed.
-// TODO(banks) note the more efficient mechanism here when implemented.
-func (t *Txn) TrackMutate(track bool) {
+//
+// Unlike iradix, nothing extra is recorded while writing. The transaction
+// always keeps the set of IDs of the snapshot nodes it replaced and Notify
+// looks those up in the tree's WatchRegistry to find the channels to close.
+func (t *Txn[V]) TrackMutate(track bool) {
 	t.trackMutate = track
 }
 
 // Insert is used to add or update a given key. The return provides
 // the previous value and a bool indicating if any was set.
-func (t *Txn) Insert(k []byte, v interface{}) (interface{}, bool) {
-	newRoot, oldVal, replaced := t.insert(t.root, k, v, 0)
-	t.root = newRoot
+func (t *Txn[V]) Insert(k []byte, v V) (V, bool) {
+	var oldVal V
+	var replaced bool
+	if t.batch {
+		oldVal, replaced = t.bufferInsert(k, v)
+	} else {
+		var newRoot *nodeHeader[V]
+		newRoot, oldVal, replaced = t.insert(t.root, t.newLeafNode(k, v), 0)
+		t.root = newRoot
+	}
+	if !replaced {
+		t.size++
+	}
+	t.recordChange(k, oldVal, replaced, v, true)
 	return oldVal, replaced
 }
 
-// insert performs a recursive insertion, copying nodes if they are from the
-// original snapshot
-func (t *Txn) insert(n *nodeHeader, k []byte, v interface{}, offset int) (*nodeHeader, interface{}, bool) {
+// insert performs a recursive insertion of newLeaf, copying nodes if they are
+// from the original snapshot
+func (t *Txn[V]) insert(n *nodeHeader[V], newLeaf *leafNode[V], offset int) (*nodeHeader[V], V, bool) {
+	var zero V
+	k := newLeaf.key
 	if n == nil {
 		// Replace with a leaf
-		newLeaf := t.newLeafNode(k, v)
-		return &newLeaf.nodeHeader, nil, false
+		return &newLeaf.nodeHeader, zero, false
 	}
 
 	// Is this a leaf node?
@@ -53,8 +85,7 @@ func (t *Txn) insert(n *nodeHeader, k []byte, v interface{}, offset int) (*nodeH
 		// Is the key identical? Replace value
 		if bytes.Equal(leaf.key, k) {
 			// Replace leaf
-			newLeaf := t.newLeafNode(k, v)
-			t.discard(n.id)
+			t.discard(n)
 			return &newLeaf.nodeHeader, leaf.value, true
 		}
 
@@ -80,8 +111,7 @@ func (t *Txn) insert(n *nodeHeader, k []byte, v interface{}, offset int) (*nodeH
 			splitNode = splitNode.addChild(t, leaf.key[offset+commonPrefixLen], n)
 		}
 
-		// Create new leaf
-		newLeaf := t.newLeafNode(k, v)
+		// Add the new leaf
 		if offset+commonPrefixLen == len(k) {
 			splitNode.setInnerLeaf(newLeaf)
 		} else {
@@ -89,56 +119,62 @@ func (t *Txn) insert(n *nodeHeader, k []byte, v interface{}, offset int) (*nodeH
 			splitNode = splitNode.addChild(t, k[offset+commonPrefixLen], &newLeaf.nodeHeader)
 		}
 		// No discard since we re-used the existing leaf node in any case above
-		return splitNode, nil, false
+		return splitNode, zero, false
+	}
+
+	pLen, _ := n.prefixFields()
+	if *pLen > 0 {
+		prefix := n.prefix(offset)
+		lcp := longestPrefix(k[offset:], prefix)
+		if lcp < len(prefix) {
+			// Need to create a new split node with the common prefix
+			splitNode := &t.newNode4().nodeHeader
+			splitNode.setPrefix(k[offset : offset+lcp])
+
+			// Copy ourselves since we need to truncate the prefix. The first
+			// mismatched byte becomes the edge from the split node so it's trimmed
+			// too. Read it first since prefix may share our prefix array.
+			edge := prefix[lcp]
+			newNode := t.copyIfNeeded(n)
+			newNode.setPrefix(prefix[lcp+1:])
+			splitNode = splitNode.addChild(t, edge, newNode)
+
+			// Add the new leaf, if the key ends exactly at the split then it
+			// belongs as the split node's inner leaf.
+			if offset+lcp == len(k) {
+				splitNode.setInnerLeaf(newLeaf)
+			} else {
+				splitNode = splitNode.addChild(t, k[offset+lcp], &newLeaf.nodeHeader)
+			}
+			return splitNode, zero, false
+		}
+
+		// Our prefix is a a prefix of the key! So consume the length and continue
+		// recursing!
+		offset += len(prefix)
 	}
 
 	if offset >= len(k) {
 		// We've already exhausted the key's bytes which means it belongs as a leaf
-		// at this inner node level.
-		newLeaf := t.newLeafNode(k, v)
+		// at this inner node level. Read the old leaf first since n may be the
+		// same node we are about to modify if it was created in this txn.
+		oldLeaf := n.innerLeaf()
 		newNode := t.copyIfNeeded(n)
 		newNode.setInnerLeaf(newLeaf)
-		t.discard(n.id)
-		if oldLeaf := n.innerLeaf(); oldLeaf != nil {
+		t.discard(n)
+		if oldLeaf != nil {
 			// There was a leaf in this inner node before, discard that too and return
 			// it's old value.
-			t.discard(oldLeaf.id)
+			t.discard(&oldLeaf.nodeHeader)
 			return newNode, oldLeaf.value, true
 		}
-		return newNode, nil, false
-	}
-
-	prefix := n.prefix()
-	if len(prefix) > 0 {
-		lcp := longestPrefix(k[offset:], prefix)
-		if lcp >= len(prefix) {
-			// Our prefix is a a prefix of the common prefix! So consume the
-			// length and continue recursing!
-			offset += len(prefix)
-			goto RECURSE
-		}
-
-		// Need to create a new split node with the common prefix
-		splitNode := &t.newNode4().nodeHeader
-		splitNode.setPrefix(k[offset : offset+lcp])
-
-		// Copy ourselves since we need to truncate the prefix
-		newNode := t.copyIfNeeded(n)
-		newNode.leftTrimPrefix(uint16(lcp))
-		splitNode = splitNode.addChild(t, prefix[lcp], newNode)
-
-		// Create a new leaf
-		newLeaf := t.newLeafNode(k, v)
-		splitNode = splitNode.addChild(t, k[lcp], &newLeaf.nodeHeader)
-		return splitNode, nil, false
+		return newNode, zero, false
 	}
 
-RECURSE:
-
 	// Find the next node to recurse to
 	child := n.findChild(k[offset])
 	if child != nil {
-		newChild, old, existed := t.insert(child, k, v, offset+1)
+		newChild, old, existed := t.insert(child, newLeaf, offset+1)
 		// Copy node to change child pointer
 		newNode := t.copyIfNeeded(n)
 		newNode = newNode.replaceChild(t, k[offset], newChild)
@@ -146,87 +182,336 @@ RECURSE:
 		return newNode, old, existed
 	}
 
-	// No child just insert a new leaf
-	newLeaf := t.newLeafNode(k, v)
+	// No child just insert the new leaf
 	newNode := t.copyIfNeeded(n)
 	newNode = newNode.addChild(t, k[offset], &newLeaf.nodeHeader)
-	t.discard(n.id)
-	return newNode, nil, false
+	t.discard(n)
+	return newNode, zero, false
 }
 
-func (t *Txn) copyIfNeeded(n *nodeHeader) *nodeHeader {
+func (t *Txn[V]) copyIfNeeded(n *nodeHeader[V]) *nodeHeader[V] {
 	if n.id <= t.maxSnapID {
 		// The old node will no longer be in the tree
-		t.discard(n.id)
+		t.discard(n)
 		return n.copy(t)
 	}
 	return n
 }
 
-func (t *Txn) discard(id uint64) {
+// discard records that n, if it was part of the snapshot, is no longer part of
+// the tree being built by this transaction.
+func (t *Txn[V]) discard(n *nodeHeader[V]) {
 	// Ignore nodes that were never in the snapshot before the txn.
-	if id > t.maxSnapID {
+	if n.id > t.maxSnapID {
 		return
 	}
 	if t.mutateSet == nil {
-		t.mutateSet = make(map[uint64]struct{})
+		t.mutateSet = make(map[uint64]*bool)
 	}
-	t.mutateSet[id] = struct{}{}
+	t.mutateSet[n.id] = &n.replaced
 }
 
 // Delete is used to delete a given key. Returns the old value if any,
 // and a bool indicating if the key was set.
-func (t *Txn) Delete(k []byte) (interface{}, bool) {
-	return nil, false
+func (t *Txn[V]) Delete(k []byte) (V, bool) {
+	var zero V
+	if t.batch {
+		oldLeaf := t.bufferDelete(k)
+		if oldLeaf == nil {
+			return zero, false
+		}
+		t.size--
+		t.recordDelete(k, oldLeaf.value)
+		return oldLeaf.value, true
+	}
+	newRoot, oldLeaf := t.delete(t.root, k, 0)
+	if oldLeaf == nil {
+		return zero, false
+	}
+	t.root = newRoot
+	t.size--
+	t.recordDelete(k, oldLeaf.value)
+	return oldLeaf.value, true
+}
+
+// delete performs a recursive deletion, copying nodes if they are from the
+// original snapshot. It returns the node that should replace n, which may be
+// nil if the whole subtree is now empty, and the leaf that was removed if any.
+// If no leaf was removed, n is returned unchanged.
+func (t *Txn[V]) delete(n *nodeHeader[V], k []byte, offset int) (*nodeHeader[V], *leafNode[V]) {
+	if n == nil {
+		return nil, nil
+	}
+
+	// Is this a leaf node?
+	if n.typ == typLeaf {
+		leaf := n.leafNode()
+		if !bytes.Equal(leaf.key, k) {
+			return n, nil
+		}
+		t.discard(n)
+		return nil, leaf
+	}
+
+	// Bail early if the prefix doesn't match. This is optimistic for long
+	// prefixes but then the leaf key comparison will fail so it's still correct.
+	if !n.checkPrefix(k, offset) {
+		return n, nil
+	}
+	depth := offset
+	pLen, _ := n.prefixFields()
+	offset += int(*pLen)
+
+	if offset == len(k) {
+		// Key ends here so can only be the inner leaf
+		leaf := n.innerLeaf()
+		if leaf == nil || !bytes.Equal(leaf.key, k) {
+			return n, nil
+		}
+		t.discard(&leaf.nodeHeader)
+		newNode := t.copyIfNeeded(n)
+		newNode.setInnerLeaf(nil)
+		return t.compress(newNode, depth), leaf
+	}
+
+	child := n.findChild(k[offset])
+	if child == nil {
+		return n, nil
+	}
+	newChild, oldLeaf := t.delete(child, k, offset+1)
+	if oldLeaf == nil {
+		// Nothing changed below us so no need to copy
+		return n, nil
+	}
+
+	newNode := t.copyIfNeeded(n)
+	if newChild == nil {
+		// Removing might shrink the node to a smaller type
+		newNode = newNode.removeChild(t, k[offset])
+	} else {
+		newNode = newNode.replaceChild(t, k[offset], newChild)
+	}
+	return t.compress(newNode, depth), oldLeaf
+}
+
+// compress fixes up an inner node that may have lost its last children or
+// inner leaf. depth is the number of key bytes consumed before n. n must
+// already be a node created in this transaction since it is no longer needed
+// by the time we return if it was compressed away.
+//
+// An inner node with no children is replaced by its inner leaf (or removed
+// entirely if it has none). A node with a single child and no inner leaf is
+// merged into that child by prepending its prefix and the edge byte to the
+// child's prefix.
+func (t *Txn[V]) compress(n *nodeHeader[V], depth int) *nodeHeader[V] {
+	leaf := n.innerLeaf()
+	switch n.numChildren() {
+	case 0:
+		if leaf == nil {
+			return nil
+		}
+		// Leaves store their whole key so don't need the prefix.
+		return &leaf.nodeHeader
+
+	case 1:
+		if leaf != nil {
+			return n
+		}
+		child := n.minChild()
+		if child.typ == typLeaf {
+			// Leaves store their whole key so can just replace us.
+			return child
+		}
+		// The child's new prefix is our prefix, the edge byte and it's own prefix.
+		// The min leaf beneath it has all of those bytes in its key even if some
+		// of the prefixes are too long to be stored in full.
+		pLen, _ := n.prefixFields()
+		childPLen, _ := child.prefixFields()
+		newLen := int(*pLen) + 1 + int(*childPLen)
+		minLeaf := child.minLeaf()
+		newChild := t.copyIfNeeded(child)
+		newChild.setPrefix(minLeaf.key[depth : depth+newLen])
+		return newChild
+	}
+	return n
 }
 
 // DeletePrefix is used to delete an entire subtree that matches the prefix
 // This will delete all nodes under that prefix
-func (t *Txn) DeletePrefix(prefix []byte) bool {
-	return false
+func (t *Txn[V]) DeletePrefix(prefix []byte) bool {
+	t.flush()
+	newRoot, numDeleted := t.deletePrefix(t.root, prefix, 0)
+	if numDeleted == 0 {
+		return false
+	}
+	t.root = newRoot
+	t.size -= numDeleted
+	return true
+}
+
+// deletePrefix performs a recursive prefix deletion. Only the path down to the
+// subtree covered by prefix is copied, the subtree itself is cut off
+// entirely. It returns the node that should replace n, which may be nil, and
+// the number of leaves removed. If nothing was removed, n is returned
+// unchanged.
+func (t *Txn[V]) deletePrefix(n *nodeHeader[V], prefix []byte, offset int) (*nodeHeader[V], int) {
+	if n == nil {
+		return nil, 0
+	}
+
+	// Is this a leaf node?
+	if n.typ == typLeaf {
+		leaf := n.leafNode()
+		if !bytes.HasPrefix(leaf.key, prefix) {
+			return n, 0
+		}
+		t.discard(n)
+		t.recordDelete(leaf.key, leaf.value)
+		return nil, 1
+	}
+
+	// Compare the whole node prefix here rather than optimistically since if the
+	// search prefix runs out inside it we'll drop the entire subtree without
+	// looking at any leaves.
+	depth := offset
+	nodePrefix := n.prefix(offset)
+	remaining := prefix[offset:]
+	lcp := longestPrefix(remaining, nodePrefix)
+	if lcp == len(remaining) {
+		// Everything below this node starts with prefix.
+		return nil, t.discardSubtree(n)
+	}
+	if lcp < len(nodePrefix) {
+		// Mismatch so nothing under here matches
+		return n, 0
+	}
+	offset += len(nodePrefix)
+
+	child := n.findChild(prefix[offset])
+	if child == nil {
+		return n, 0
+	}
+	newChild, numDeleted := t.deletePrefix(child, prefix, offset+1)
+	if numDeleted == 0 {
+		// Nothing changed below us so no need to copy
+		return n, 0
+	}
+
+	newNode := t.copyIfNeeded(n)
+	if newChild == nil {
+		newNode = newNode.removeChild(t, prefix[offset])
+	} else {
+		newNode = newNode.replaceChild(t, prefix[offset], newChild)
+	}
+	return t.compress(newNode, depth), numDeleted
 }
 
-func (t *Txn) Commit() *Tree {
+// discardSubtree records every node in the subtree rooted at n as removed
+// and returns the number of leaves in it.
+func (t *Txn[V]) discardSubtree(n *nodeHeader[V]) int {
+	t.discard(n)
+	if n.typ == typLeaf {
+		leaf := n.leafNode()
+		t.recordDelete(leaf.key, leaf.value)
+		return 1
+	}
+	numLeaves := 0
+	if leaf := n.innerLeaf(); leaf != nil {
+		t.discard(&leaf.nodeHeader)
+		t.recordDelete(leaf.key, leaf.value)
+		numLeaves++
+	}
+	for _, child := range n.childSlice() {
+		if child != nil {
+			numLeaves += t.discardSubtree(child)
+		}
+	}
+	return numLeaves
+}
+
+// Commit is used to finalize the transaction and return a new tree. If
+// mutation tracking is turned on then notifications will also be issued.
+func (t *Txn[V]) Commit() *Tree[V] {
+	nt := t.CommitOnly()
 	t.Notify()
-	return t.CommitOnly()
+	return nt
 }
 
-func (t *Txn) CommitOnly() *Tree {
-	return &Tree{
-		root:  t.root,
-		maxID: t.maxRootID,
-		size:  t.size,
+// CommitOnly is used to finalize the transaction and return a new tree, but
+// does not issue any notifications until Notify is called.
+func (t *Txn[V]) CommitOnly() *Tree[V] {
+	t.flush()
+	nt := &Tree[V]{
+		root:    t.root,
+		maxID:   t.maxRootID,
+		size:    t.size,
+		version: &treeVersion{},
 	}
+	if t.tree != nil {
+		nt.watches = t.tree.watches
+	}
+	t.committed = nt
+	return nt
 }
 
-func (t *Txn) Get(k []byte) (interface{}, bool) {
-	return nil, false
+// Get is used to lookup a specific key, returning the value and if it was
+// found. It sees any writes made earlier in the transaction.
+func (t *Txn[V]) Get(k []byte) (V, bool) {
+	if t.batch {
+		return t.bufferGet(k)
+	}
+	return t.Root().Get(k)
 }
 
-func (t *Txn) GetWatch(k []byte) (<-chan struct{}, interface{}, bool) {
-	return nil, nil, false
+// GetWatch is used to lookup a specific key, returning the watch channel,
+// value and if it was found.
+func (t *Txn[V]) GetWatch(k []byte) (<-chan struct{}, V, bool) {
+	return t.Root().GetWatch(k)
 }
 
-func (t *Txn) Notify() {
+// Notify is used along with TrackMutate to trigger notifications. This must
+// only be done once a transaction is committed via CommitOnly, and it is
+// called automatically by Commit.
+func (t *Txn[V]) Notify() {
+	if !t.trackMutate || t.tree == nil || t.tree.watches == nil {
+		return
+	}
+	// Anyone watching the tree itself, for a key being added to an empty tree
+	// or beside a leaf root, needs to know too.
+	var version *treeVersion
+	if t.root != t.snap {
+		version = t.tree.version
+	}
+	if version == nil && len(t.mutateSet) == 0 {
+		return
+	}
+	t.tree.watches.notify(version, t.mutateSet)
+}
 
+// Len returns the number of elements in the tree including any changes made
+// so far in this transaction.
+func (t *Txn[V]) Len() int {
+	return t.size
 }
 
 // Root returns the current root of the radix tree within this
 // transaction. The root is not safe across insert and delete operations,
-// but can be used to read the current state during a transaction.
-func (t *Txn) Root() *APINode {
-	return &APINode{t.root}
+// but can be used to read the current state during a transaction. In batch
+// mode any buffered writes are merged first.
+func (t *Txn[V]) Root() *APINode[V] {
+	t.flush()
+	return &APINode[V]{h: t.root, tree: t.tree}
 }
 
-func (t *Txn) nextID() uint64 {
+func (t *Txn[V]) nextID() uint64 {
 	t.maxRootID++
 	return t.maxRootID
 }
 
-func (t *Txn) newNode4() *node4 {
-	n := &node4{
-		innerNodeHeader: innerNodeHeader{
-			nodeHeader: nodeHeader{
+func (t *Txn[V]) newNode4() *node4[V] {
+	n := &node4[V]{
+		innerNodeHeader: innerNodeHeader[V]{
+			nodeHeader: nodeHeader[V]{
 				id:  t.nextID(),
 				typ: typNode4,
 			},
@@ -236,10 +521,10 @@ func (t *Txn) newNode4() *node4 {
 	return n
 }
 
-func (t *Txn) newNode16() *node16 {
-	n := &node16{
-		innerNodeHeader: innerNodeHeader{
-			nodeHeader: nodeHeader{
+func (t *Txn[V]) newNode16() *node16[V] {
+	n := &node16[V]{
+		innerNodeHeader: innerNodeHeader[V]{
+			nodeHeader: nodeHeader[V]{
 				id:  t.nextID(),
 				typ: typNode16,
 			},
@@ -249,10 +534,10 @@ func (t *Txn) newNode16() *node16 {
 	return n
 }
 
-func (t *Txn) newNode48() *node48 {
-	n := &node48{
-		innerNodeHeader: innerNodeHeader{
-			nodeHeader: nodeHeader{
+func (t *Txn[V]) newNode48() *node48[V] {
+	n := &node48[V]{
+		innerNodeHeader: innerNodeHeader[V]{
+			nodeHeader: nodeHeader[V]{
 				id:  t.nextID(),
 				typ: typNode48,
 			},
@@ -262,10 +547,10 @@ func (t *Txn) newNode48() *node48 {
 	return n
 }
 
-func (t *Txn) newNode256() *node256 {
-	n := &node256{
-		innerNodeHeader: innerNodeHeader{
-			nodeHeader: nodeHeader{
+func (t *Txn[V]) newNode256() *node256[V] {
+	n := &node256[V]{
+		innerNodeHeader: innerNodeHeader[V]{
+			nodeHeader: nodeHeader[V]{
 				id:  t.nextID(),
 				typ: typNode256,
 			},
@@ -275,9 +560,9 @@ func (t *Txn) newNode256() *node256 {
 	return n
 }
 
-func (t *Txn) newLeafNode(k []byte, v interface{}) *leafNode {
-	n := &leafNode{
-		nodeHeader: nodeHeader{
+func (t *Txn[V]) newLeafNode(k []byte, v V) *leafNode[V] {
+	n := &leafNode[V]{
+		nodeHeader: nodeHeader[V]{
 			id:  t.nextID(),
 			typ: typLeaf,
 		},
@@ -0,0 +1,229 @@
+package art
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Validate walks every node in the tree and checks the structural invariants
+// that insert and delete are meant to maintain. It's intended for debugging
+// and tests since it visits the whole tree. The first problem found is
+// returned as an error.
+//
+// The invariants checked are:
+//   - every inner node has a child count in the range for its type, node4 up to
+//     4, node16 5-16, node48 17-48 and node256 49 or more, and no unused child
+//     slots are set;
+//   - the indexes of node4 and node16 are strictly increasing and the node48
+//     index has exactly nChildren entries, each pointing at a distinct child;
+//   - inner nodes have at least one child and, if they have only one, an inner
+//     leaf, since otherwise they should have been compressed away;
+//   - stored prefixes match the keys of every leaf below the node, inner
+//     leaves end exactly at the end of their node's prefix and every leaf
+//     below a child has the child's edge byte at the right depth;
+//   - node IDs are unique and no greater than the tree's maxID;
+//   - the number of leaves matches Len.
+func (t *Tree[V]) Validate() error {
+	v := &validator[V]{
+		maxID: t.maxID,
+		ids:   make(map[uint64]struct{}),
+	}
+	if t.root != nil {
+		if err := v.validate(t.root, nil); err != nil {
+			return err
+		}
+	}
+	if v.numLeaves != t.size {
+		return fmt.Errorf("tree has %d leaves but Len is %d", v.numLeaves, t.size)
+	}
+	return nil
+}
+
+// validator holds the state of a single Validate walk.
+type validator[V any] struct {
+	maxID     uint64
+	ids       map[uint64]struct{}
+	numLeaves int
+}
+
+// validate checks the subtree rooted at n. path holds every key byte on the
+// way to n so all keys below it must start with path.
+func (v *validator[V]) validate(n *nodeHeader[V], path []byte) error {
+	if err := v.validateID(n); err != nil {
+		return err
+	}
+
+	if n.typ == typLeaf {
+		leaf := n.leafNode()
+		if !bytes.HasPrefix(leaf.key, path) {
+			return fmt.Errorf("leaf %d with key %q is below path %q", n.id, leaf.key, path)
+		}
+		v.numLeaves++
+		return nil
+	}
+
+	if err := v.validateChildren(n); err != nil {
+		return err
+	}
+
+	// Recover the whole prefix from a leaf. It must agree with the stored part
+	// and every other leaf is checked against it as we go down.
+	pLen, pBytes := n.prefixFields()
+	depth := len(path)
+	minLeaf := n.minLeaf()
+	if len(minLeaf.key) < depth+int(*pLen) {
+		return fmt.Errorf("%s %d has prefix length %d at depth %d but leaf %q is too short",
+			typName(n.typ), n.id, *pLen, depth, minLeaf.key)
+	}
+	prefix := minLeaf.key[depth : depth+int(*pLen)]
+	stored := pBytes[0:min(int(*pLen), maxPrefixLen)]
+	if !bytes.Equal(stored, prefix[0:len(stored)]) {
+		return fmt.Errorf("%s %d has prefix %q but leaf %q has %q at depth %d",
+			typName(n.typ), n.id, stored, minLeaf.key, prefix, depth)
+	}
+	path = append(path[0:depth:depth], prefix...)
+
+	if leaf := n.innerLeaf(); leaf != nil {
+		if err := v.validateID(&leaf.nodeHeader); err != nil {
+			return err
+		}
+		if !bytes.Equal(leaf.key, path) {
+			return fmt.Errorf("%s %d has inner leaf %q but its path is %q",
+				typName(n.typ), n.id, leaf.key, path)
+		}
+		v.numLeaves++
+	}
+
+	for c := 0; c < 256; {
+		edge, child := n.lowerBound(c)
+		if child == nil {
+			break
+		}
+		if err := v.validate(child, append(path[0:len(path):len(path)], byte(edge))); err != nil {
+			return err
+		}
+		c = edge + 1
+	}
+	return nil
+}
+
+// validateID checks the ID of n is in range and not used by any other node.
+func (v *validator[V]) validateID(n *nodeHeader[V]) error {
+	if n.id > v.maxID {
+		return fmt.Errorf("%s %d has ID greater than maxID %d", typName(n.typ), n.id, v.maxID)
+	}
+	if _, ok := v.ids[n.id]; ok {
+		return fmt.Errorf("%s %d has the same ID as another node", typName(n.typ), n.id)
+	}
+	v.ids[n.id] = struct{}{}
+	return nil
+}
+
+// validateChildren checks the child count, index and child array of the inner
+// node n.
+func (v *validator[V]) validateChildren(n *nodeHeader[V]) error {
+	var minChildren, maxChildren int
+	var index []byte
+	var children []*nodeHeader[V]
+	var nChildren uint16
+
+	switch n.typ {
+	case typNode4:
+		n4 := n.node4()
+		minChildren, maxChildren = 1, 4
+		index, children, nChildren = n4.index[:], n4.children[:], n4.nChildren
+
+	case typNode16:
+		n16 := n.node16()
+		minChildren, maxChildren = 5, 16
+		index, children, nChildren = n16.index[:], n16.children[:], n16.nChildren
+
+	case typNode48:
+		n48 := n.node48()
+		minChildren, maxChildren = 17, 48
+		children, nChildren = n48.children[:], n48.nChildren
+
+		// Every index entry is an offset into children plus one, or zero if
+		// there is no child with that next byte.
+		seen := make([]bool, len(n48.children))
+		numIndexed := 0
+		for c, idx := range n48.index {
+			if idx == 0 {
+				continue
+			}
+			if int(idx) > int(nChildren) {
+				return fmt.Errorf("node48 %d has index %d for %q but only %d children",
+					n.id, idx, byte(c), nChildren)
+			}
+			if seen[idx-1] {
+				return fmt.Errorf("node48 %d has index %d for %q more than once", n.id, idx, byte(c))
+			}
+			seen[idx-1] = true
+			numIndexed++
+		}
+		if numIndexed != int(nChildren) {
+			return fmt.Errorf("node48 %d has %d index entries but %d children", n.id, numIndexed, nChildren)
+		}
+
+	case typNode256:
+		n256 := n.node256()
+		minChildren, maxChildren = 49, 256
+		nChildren = n256.nChildren
+		numSet := 0
+		for _, child := range n256.children {
+			if child != nil {
+				numSet++
+			}
+		}
+		if numSet != int(nChildren) {
+			return fmt.Errorf("node256 %d has %d children set but nChildren is %d", n.id, numSet, nChildren)
+		}
+
+	default:
+		return fmt.Errorf("node %d has invalid type %d", n.id, n.typ)
+	}
+
+	if int(nChildren) < minChildren || int(nChildren) > maxChildren {
+		return fmt.Errorf("%s %d has %d children, must be %d-%d",
+			typName(n.typ), n.id, nChildren, minChildren, maxChildren)
+	}
+	if nChildren == 1 && n.innerLeaf() == nil {
+		return fmt.Errorf("%s %d has a single child and no inner leaf", typName(n.typ), n.id)
+	}
+
+	// node256 children are indexed directly so were counted above.
+	if n.typ != typNode256 {
+		for i, child := range children {
+			if i < int(nChildren) && child == nil {
+				return fmt.Errorf("%s %d has nil child at %d", typName(n.typ), n.id, i)
+			}
+			if i >= int(nChildren) && child != nil {
+				return fmt.Errorf("%s %d has child set at unused slot %d", typName(n.typ), n.id, i)
+			}
+		}
+	}
+	for i := 1; i < int(nChildren) && index != nil; i++ {
+		if index[i-1] >= index[i] {
+			return fmt.Errorf("%s %d has index out of order at %d: %q", typName(n.typ), n.id, i,
+				index[0:nChildren])
+		}
+	}
+	return nil
+}
+
+// typName returns a readable name for a node type for error messages.
+func typName(typ uint8) string {
+	switch typ {
+	case typLeaf:
+		return "leaf"
+	case typNode4:
+		return "node4"
+	case typNode16:
+		return "node16"
+	case typNode48:
+		return "node48"
+	case typNode256:
+		return "node256"
+	}
+	return fmt.Sprintf("type(%d)", typ)
+}
@@ -0,0 +1,137 @@
+package art
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	keys := testKeys()
+
+	for seed := int64(0); seed < 20; seed++ {
+		t.Run(fmt.Sprintf("seed-%d", seed), func(t *testing.T) {
+			require := require.New(t)
+			r := rand.New(rand.NewSource(seed))
+
+			tree := New()
+			require.NoError(tree.Validate())
+			for i := 0; i < 500; i++ {
+				k := []byte(keys[r.Intn(len(keys))])
+				switch op := r.Intn(10); {
+				case op < 6:
+					tree, _, _ = tree.Insert(k, i)
+				case op < 9:
+					tree, _, _ = tree.Delete(k)
+				default:
+					tree, _ = tree.DeletePrefix(k[0:r.Intn(len(k)+1)])
+				}
+				require.NoError(tree.Validate(), "after op %d on %q", i, k)
+			}
+		})
+	}
+}
+
+func TestValidateDetectsCorruption(t *testing.T) {
+	// Each case breaks a copy of a valid tree in one way. The tree has a
+	// node256 root under "wide/" so each case finds the node it needs.
+	findNode := func(tree *Tree[any], prefix string) *nodeHeader[any] {
+		n := tree.root
+		depth := 0
+		for n.typ != typLeaf {
+			pLen, _ := n.prefixFields()
+			depth += int(*pLen)
+			if depth >= len(prefix) {
+				return n
+			}
+			n = n.findChild(prefix[depth])
+			depth++
+		}
+		return n
+	}
+
+	tests := []struct {
+		name    string
+		corrupt func(tree *Tree[any])
+		wantErr string
+	}{
+		{
+			name: "len",
+			corrupt: func(tree *Tree[any]) {
+				tree.size++
+			},
+			wantErr: "leaves but Len",
+		},
+		{
+			name: "max-id",
+			corrupt: func(tree *Tree[any]) {
+				tree.maxID = tree.root.id - 1
+			},
+			wantErr: "greater than maxID",
+		},
+		{
+			name: "prefix",
+			corrupt: func(tree *Tree[any]) {
+				n := findNode(tree, "foo/ba")
+				_, pBytes := n.prefixFields()
+				pBytes[0] = 'X'
+			},
+			wantErr: "has prefix",
+		},
+		{
+			name: "index-order",
+			corrupt: func(tree *Tree[any]) {
+				n4 := findNode(tree, "foo/ba").node4()
+				n4.index[0], n4.index[1] = n4.index[1], n4.index[0]
+				n4.children[0], n4.children[1] = n4.children[1], n4.children[0]
+			},
+			wantErr: "out of order",
+		},
+		{
+			name: "node256-count",
+			corrupt: func(tree *Tree[any]) {
+				n256 := findNode(tree, "wide/").node256()
+				n256.nChildren--
+			},
+			wantErr: "children set but nChildren",
+		},
+		{
+			name: "node256-underfull",
+			corrupt: func(tree *Tree[any]) {
+				n256 := findNode(tree, "wide/").node256()
+				for c := 0; n256.nChildren > 48; c++ {
+					if n256.children[c] != nil {
+						n256.children[c] = nil
+						n256.nChildren--
+						tree.size--
+					}
+				}
+			},
+			wantErr: "children, must be 49-256",
+		},
+		{
+			name: "edge",
+			corrupt: func(tree *Tree[any]) {
+				n256 := findNode(tree, "wide/").node256()
+				n256.children['a'], n256.children['b'] = n256.children['b'], n256.children['a']
+			},
+			wantErr: "is below path",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			require := require.New(t)
+
+			// Build a fresh tree each time since the corruption is done in place.
+			tree := testBuildTree(testKeys(), 1)
+			require.NoError(tree.Validate())
+			tc.corrupt(tree)
+			err := tree.Validate()
+			require.Error(err)
+			require.Contains(err.Error(), tc.wantErr)
+		})
+	}
+}
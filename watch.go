@@ -0,0 +1,120 @@
+package art
+
+import (
+	"sync"
+)
+
+// closedWatch is returned to anyone who asks to watch something that has
+// already changed.
+var closedWatch = func() chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}()
+
+// treeVersion holds the state of a single Tree that watches need. Its fields
+// are protected by the lock in the WatchRegistry.
+type treeVersion struct {
+	// replaced is set once a commit from the tree is notified.
+	replaced bool
+
+	// ch is closed when replaced is set. It's only made once someone watches
+	// the version.
+	ch chan struct{}
+}
+
+// WatchRegistry keeps track of the channels waiting for nodes to be replaced,
+// keyed by node ID. A single registry is shared by every Tree derived from the
+// same New tree, and every watcher of the same ID shares one channel, so
+// memory used for watching scales with the number of watched nodes rather than
+// the number of nodes or watch calls.
+//
+// Transactions started from the same Tree can assign the same IDs to different
+// nodes so committing more than one of them can wake watchers spuriously, but
+// never miss a change.
+type WatchRegistry struct {
+	l       sync.Mutex
+	waiters map[uint64]chan struct{}
+}
+
+func newWatchRegistry() *WatchRegistry {
+	return &WatchRegistry{
+		waiters: make(map[uint64]chan struct{}),
+	}
+}
+
+// Len returns the number of node IDs that currently have waiters.
+func (r *WatchRegistry) Len() int {
+	r.l.Lock()
+	defer r.l.Unlock()
+	return len(r.waiters)
+}
+
+// watch returns a channel that is closed when the node with the given ID in
+// the tree with version v is replaced by a commit. replaced is the node's flag
+// that notify sets.
+//
+// Nodes are shared by every tree forked from the same snapshot so a set flag
+// only means some commit replaced the node. If v has been replaced too then
+// that commit may have been made from v or a later tree and the returned
+// channel is already closed. Otherwise it was made from a fork and v is
+// watched instead, so the watcher waits for v's own next commit.
+func (r *WatchRegistry) watch(v *treeVersion, replaced *bool, id uint64) <-chan struct{} {
+	r.l.Lock()
+	defer r.l.Unlock()
+
+	if *replaced {
+		return r.watchVersionLocked(v)
+	}
+	ch, ok := r.waiters[id]
+	if !ok {
+		ch = make(chan struct{})
+		r.waiters[id] = ch
+	}
+	return ch
+}
+
+// watchVersion returns a channel that is closed when a commit from the tree
+// with version v is notified. It's used to watch the root slot of a tree since
+// an empty tree or one that is just a single leaf has no inner node to watch.
+func (r *WatchRegistry) watchVersion(v *treeVersion) <-chan struct{} {
+	r.l.Lock()
+	defer r.l.Unlock()
+	return r.watchVersionLocked(v)
+}
+
+func (r *WatchRegistry) watchVersionLocked(v *treeVersion) <-chan struct{} {
+	if v.replaced {
+		return closedWatch
+	}
+	if v.ch == nil {
+		v.ch = make(chan struct{})
+	}
+	return v.ch
+}
+
+// notify marks version v, if it's not nil, and every node in replaced, which is
+// keyed by node ID, as replaced by a commit and closes the channels of any
+// waiters on them.
+func (r *WatchRegistry) notify(v *treeVersion, replaced map[uint64]*bool) {
+	r.l.Lock()
+	defer r.l.Unlock()
+
+	if v != nil && !v.replaced {
+		v.replaced = true
+		if v.ch != nil {
+			close(v.ch)
+			v.ch = nil
+		}
+	}
+	for id, flag := range replaced {
+		// Flag the node so that late watchers of older trees that still hold it
+		// know it's gone. The flag lives in the node rather than the registry so
+		// it's freed along with the last tree that can reach it.
+		*flag = true
+		if ch, ok := r.waiters[id]; ok {
+			close(ch)
+			delete(r.waiters, id)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package art
+
+import (
+	"context"
+	"reflect"
+	"time"
+)
+
+// aFew is the number of channels watched together in a single select. Sets
+// larger than this are split into chunks that are each watched by their own
+// goroutine.
+const aFew = 32
+
+// WatchSet is a collection of watch channels, for example from GetWatch and
+// WatchPrefix, that can be waited on together.
+type WatchSet map[<-chan struct{}]struct{}
+
+// NewWatchSet constructs a new watch set.
+func NewWatchSet() WatchSet {
+	return make(map[<-chan struct{}]struct{})
+}
+
+// Add appends a watchCh to the WatchSet if non-nil.
+func (w WatchSet) Add(watchCh <-chan struct{}) {
+	if w == nil || watchCh == nil {
+		return
+	}
+	w[watchCh] = struct{}{}
+}
+
+// AddWithLimit appends a watchCh to the WatchSet if non-nil, and if the given
+// softLimit hasn't been exceeded. Otherwise, it will watch the given alternate
+// channel. It's expected that the altCh will be the same on many calls to this
+// function, so you will exceed the soft limit a little bit if you hit this, but
+// not by much.
+//
+// This is useful if you want to track individual items up to some limit, after
+// which you watch a higher-level channel such as a WatchPrefix on the whole
+// range so you don't track too many channels.
+func (w WatchSet) AddWithLimit(softLimit int, watchCh <-chan struct{}, altCh <-chan struct{}) {
+	if len(w) < softLimit {
+		w.Add(watchCh)
+	} else {
+		w.Add(altCh)
+	}
+}
+
+// Watch is used to wait for either the watch set to trigger or a timeout.
+// Returns true on timeout.
+func (w WatchSet) Watch(timeoutCh <-chan time.Time) bool {
+	if w == nil {
+		return false
+	}
+
+	// Create a context that gets cancelled when the timeout is triggered
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		select {
+		case <-timeoutCh:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return w.WatchCtx(ctx) == context.Canceled
+}
+
+// WatchCtx is used to wait for either the watch set to trigger or for the
+// context to be cancelled. It returns nil if a channel fired or the context's
+// error otherwise.
+func (w WatchSet) WatchCtx(ctx context.Context) error {
+	if w == nil {
+		return nil
+	}
+
+	chs := make([]<-chan struct{}, 0, len(w))
+	for ch := range w {
+		chs = append(chs, ch)
+	}
+
+	if len(chs) <= aFew {
+		return watchFew(ctx, chs)
+	}
+
+	// Watch each chunk in its own goroutine. The first to return, either
+	// because a channel fired or the parent context was cancelled, cancels all
+	// the others.
+	chunkCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	fired := make(chan struct{}, 1)
+	for start := 0; start < len(chs); start += aFew {
+		end := min(start+aFew, len(chs))
+		go func(chunk []<-chan struct{}) {
+			if watchFew(chunkCtx, chunk) == nil {
+				select {
+				case fired <- struct{}{}:
+				default:
+				}
+				cancel()
+			}
+		}(chs[start:end])
+	}
+
+	select {
+	case <-fired:
+		return nil
+	case <-chunkCtx.Done():
+		// Either a chunk fired and cancelled us or the parent was cancelled. A
+		// fired chunk always signals before cancelling.
+		select {
+		case <-fired:
+			return nil
+		default:
+			return ctx.Err()
+		}
+	}
+}
+
+// watchFew blocks until one of chs is closed, returning nil, or ctx is done,
+// returning its error.
+func watchFew(ctx context.Context, chs []<-chan struct{}) error {
+	cases := make([]reflect.SelectCase, 0, len(chs)+1)
+	cases = append(cases, reflect.SelectCase{
+		Dir:  reflect.SelectRecv,
+		Chan: reflect.ValueOf(ctx.Done()),
+	})
+	for _, ch := range chs {
+		cases = append(cases, reflect.SelectCase{
+			Dir:  reflect.SelectRecv,
+			Chan: reflect.ValueOf(ch),
+		})
+	}
+
+	chosen, _, _ := reflect.Select(cases)
+	if chosen == 0 {
+		return ctx.Err()
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package art
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatchSetWatch(t *testing.T) {
+	require := require.New(t)
+
+	ws := NewWatchSet()
+	ch1 := make(chan struct{})
+	ch2 := make(chan struct{})
+	ws.Add(ch1)
+	ws.Add(ch2)
+	ws.Add(nil)
+	require.Len(ws, 2)
+
+	// Times out with nothing firing
+	require.True(ws.Watch(time.After(10 * time.Millisecond)))
+
+	// Returns without timing out once one fires
+	close(ch2)
+	require.False(ws.Watch(time.After(time.Minute)))
+
+	// A nil set never blocks
+	var nilWS WatchSet
+	require.False(nilWS.Watch(nil))
+}
+
+func TestWatchSetAddWithLimit(t *testing.T) {
+	require := require.New(t)
+
+	ws := NewWatchSet()
+	alt := make(chan struct{})
+	for i := 0; i < 10; i++ {
+		ws.AddWithLimit(3, make(chan struct{}), alt)
+	}
+	require.Len(ws, 4)
+	_, ok := ws[alt]
+	require.True(ok)
+}
+
+func TestWatchSetWatchCtx(t *testing.T) {
+	for _, n := range []int{1, aFew, aFew + 1, 1000} {
+		t.Run(fmt.Sprintf("%d", n), func(t *testing.T) {
+			require := require.New(t)
+
+			ws := NewWatchSet()
+			chs := make([]chan struct{}, n)
+			for i := range chs {
+				chs[i] = make(chan struct{})
+				ws.Add(chs[i])
+			}
+
+			// Cancelled context
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+			require.Equal(context.DeadlineExceeded, ws.WatchCtx(ctx))
+
+			// Fire the last one
+			close(chs[n-1])
+			require.NoError(ws.WatchCtx(context.Background()))
+		})
+	}
+}
+
+func TestWatchSetWithTree(t *testing.T) {
+	require := require.New(t)
+
+	tree := testBuildTree(testKeys(), 13)
+
+	ws := NewWatchSet()
+	for _, k := range testKeys() {
+		ch, _, _ := tree.GetWatch([]byte(k))
+		ws.Add(ch)
+	}
+	ws.Add(tree.WatchPrefix([]byte("foo/")))
+	require.Greater(len(ws), aFew)
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- ws.WatchCtx(context.Background())
+	}()
+
+	select {
+	case <-errCh:
+		t.Fatal("watch returned before any change")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	testCommitTracked(tree, func(txn *Txn[any]) { txn.Insert([]byte("wide/a"), 1) })
+
+	select {
+	case err := <-errCh:
+		require.NoError(err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("watch didn't return after change")
+	}
+}
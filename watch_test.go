@@ -0,0 +1,372 @@
+package art
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testIsClosed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+// testCommitTracked applies fn in a transaction with mutation tracking enabled
+// and commits it.
+func testCommitTracked(tree *Tree[any], fn func(txn *Txn[any])) *Tree[any] {
+	txn := tree.Txn()
+	txn.TrackMutate(true)
+	fn(txn)
+	return txn.Commit()
+}
+
+func TestGetWatch(t *testing.T) {
+	keys := testKeys()
+
+	cases := []struct {
+		name  string
+		watch string
+		fn    func(txn *Txn[any])
+		fires bool
+	}{
+		{
+			name:  "update watched key",
+			watch: "foo/bar",
+			fn:    func(txn *Txn[any]) { txn.Insert([]byte("foo/bar"), 1) },
+			fires: true,
+		},
+		{
+			name:  "delete watched key",
+			watch: "foo/bar",
+			fn:    func(txn *Txn[any]) { txn.Delete([]byte("foo/bar")) },
+			fires: true,
+		},
+		{
+			name:  "update watched inner leaf",
+			watch: "foo",
+			fn:    func(txn *Txn[any]) { txn.Insert([]byte("foo"), 1) },
+			fires: true,
+		},
+		{
+			name:  "delete prefix of watched key",
+			watch: "foo/bar/baz",
+			fn:    func(txn *Txn[any]) { txn.DeletePrefix([]byte("foo/")) },
+			fires: true,
+		},
+		{
+			name:  "update other key",
+			watch: "foo/bar",
+			fn:    func(txn *Txn[any]) { txn.Insert([]byte("foo/baz"), 1) },
+			fires: false,
+		},
+		{
+			name:  "add child below watched key",
+			watch: "foo/bar",
+			fn:    func(txn *Txn[any]) { txn.Insert([]byte("foo/bar/qux"), 1) },
+			fires: false,
+		},
+		{
+			name:  "insert missing key",
+			watch: "foo/qux",
+			fn:    func(txn *Txn[any]) { txn.Insert([]byte("foo/qux"), 1) },
+			fires: true,
+		},
+		{
+			name:  "insert missing key splitting leaf",
+			watch: "foo/bax",
+			fn:    func(txn *Txn[any]) { txn.Insert([]byte("foo/bax"), 1) },
+			fires: true,
+		},
+		{
+			name:  "insert missing key splitting prefix",
+			watch: "mid",
+			fn:    func(txn *Txn[any]) { txn.Insert([]byte("mid"), 1) },
+			fires: true,
+		},
+		{
+			name:  "insert missing key in long prefix",
+			watch: "this/is/a/very/long/shared/prefiX",
+			fn: func(txn *Txn[any]) {
+				txn.Insert([]byte("this/is/a/very/long/shared/prefiX"), 1)
+			},
+			fires: true,
+		},
+		{
+			name:  "insert missing key below long prefix",
+			watch: testLongPrefix + "bb/and/then/another/long/bat",
+			fn: func(txn *Txn[any]) {
+				txn.Insert([]byte(testLongPrefix+"bb/and/then/another/long/bat"), 1)
+			},
+			fires: true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			require := require.New(t)
+			tree := testBuildTree(keys, 8)
+
+			// Watch a key we don't touch too to make sure it doesn't fire
+			otherCh, _, ok := tree.GetWatch([]byte("wide/a"))
+			require.True(ok)
+
+			ch, _, _ := tree.GetWatch([]byte(tc.watch))
+			require.NotNil(ch)
+			require.False(testIsClosed(ch))
+
+			testCommitTracked(tree, tc.fn)
+			require.Equal(tc.fires, testIsClosed(ch))
+			require.False(testIsClosed(otherCh))
+		})
+	}
+}
+
+func TestGetWatchRoot(t *testing.T) {
+	require := require.New(t)
+
+	// Empty tree
+	tree := New()
+	ch, _, ok := tree.GetWatch([]byte("foo"))
+	require.False(ok)
+	tree = testCommitTracked(tree, func(txn *Txn[any]) { txn.Insert([]byte("foo"), 1) })
+	require.True(testIsClosed(ch))
+
+	// Single leaf at the root
+	ch, _, ok = tree.GetWatch([]byte("bar"))
+	require.False(ok)
+	fooCh, _, ok := tree.GetWatch([]byte("foo"))
+	require.True(ok)
+	tree = testCommitTracked(tree, func(txn *Txn[any]) { txn.Insert([]byte("bar"), 1) })
+	require.True(testIsClosed(ch))
+	require.False(testIsClosed(fooCh))
+
+	// Watching a node that has already been replaced fires straight away
+	old := tree
+	testCommitTracked(tree, func(txn *Txn[any]) { txn.Insert([]byte("baz"), 1) })
+	ch, _, _ = old.GetWatch([]byte("baz"))
+	require.True(testIsClosed(ch))
+}
+
+func TestGetWatchNotifyControl(t *testing.T) {
+	require := require.New(t)
+
+	tree := testBuildTree(testKeys(), 9)
+	ch, _, _ := tree.GetWatch([]byte("foo"))
+
+	// Without tracking nothing fires
+	txn := tree.Txn()
+	txn.Insert([]byte("foo"), 1)
+	txn.Commit()
+	require.False(testIsClosed(ch))
+
+	// CommitOnly doesn't fire until Notify
+	txn = tree.Txn()
+	txn.TrackMutate(true)
+	txn.Insert([]byte("foo"), 2)
+	txn.CommitOnly()
+	require.False(testIsClosed(ch))
+	txn.Notify()
+	require.True(testIsClosed(ch))
+}
+
+// testEachNode calls fn for every node in the subtree including inner leaves.
+func testEachNode(n *nodeHeader[any], fn func(n *nodeHeader[any])) {
+	if n == nil {
+		return
+	}
+	fn(n)
+	if leaf := n.innerLeaf(); leaf != nil {
+		fn(&leaf.nodeHeader)
+	}
+	for _, child := range n.childSlice() {
+		testEachNode(child, fn)
+	}
+}
+
+func TestNotifyClosesExactlyMutated(t *testing.T) {
+	ops := map[string]func(txn *Txn[any]){
+		"insert":       func(txn *Txn[any]) { txn.Insert([]byte("foo/bar/qux"), 1) },
+		"update":       func(txn *Txn[any]) { txn.Insert([]byte("wide/a"), 1) },
+		"delete":       func(txn *Txn[any]) { txn.Delete([]byte("foo/bar")) },
+		"delete-inner": func(txn *Txn[any]) { txn.Delete([]byte("foo")) },
+		"delete-prefix": func(txn *Txn[any]) {
+			txn.DeletePrefix([]byte(testLongPrefix + "b"))
+		},
+		"shrink": func(txn *Txn[any]) {
+			txn.DeletePrefix([]byte("wide/"))
+			txn.Insert([]byte("wide/a"), 1)
+		},
+		"many": func(txn *Txn[any]) {
+			for _, k := range testKeys()[0:30] {
+				txn.Insert([]byte(k+"/new"), 1)
+			}
+		},
+	}
+
+	for name, fn := range ops {
+		t.Run(name, func(t *testing.T) {
+			tree := testBuildTree(testKeys(), 10)
+
+			watches := make(map[*nodeHeader[any]]<-chan struct{})
+			testEachNode(tree.root, func(n *nodeHeader[any]) {
+				watches[n] = tree.watches.watch(tree.version, &n.replaced, n.id)
+			})
+
+			txn := tree.Txn()
+			txn.TrackMutate(true)
+			fn(txn)
+			require.NotEmpty(t, txn.mutateSet)
+			txn.Commit()
+
+			for n, ch := range watches {
+				_, mutated := txn.mutateSet[n.id]
+				require.Equal(t, mutated, testIsClosed(ch), "node %d", n.id)
+			}
+		})
+	}
+}
+
+func TestWatchRegistry(t *testing.T) {
+	require := require.New(t)
+
+	tree := testBuildTree(testKeys(), 11)
+	reg := tree.WatchRegistry()
+	require.NotNil(reg)
+	require.Zero(reg.Len(), "nothing is registered until someone watches")
+
+	ch1, _, _ := tree.GetWatch([]byte("foo"))
+	ch2, _, _ := tree.GetWatch([]byte("foo"))
+	ch3, _, _ := tree.GetWatch([]byte("wide/a"))
+	require.Equal(2, reg.Len())
+	require.Equal(ch1, ch2, "watchers of the same node share a channel")
+
+	// Re-watching an unchanged key doesn't register anything new.
+	for i := 0; i < 1000; i++ {
+		ch, _, _ := tree.GetWatch([]byte("foo"))
+		require.Equal(ch1, ch)
+	}
+	require.Equal(2, reg.Len())
+	require.Len(reg.waiters, 2)
+
+	// Trees committed from this one share the registry
+	tree2 := testCommitTracked(tree, func(txn *Txn[any]) { txn.Insert([]byte("foo"), 1) })
+	require.Same(reg, tree2.WatchRegistry())
+	require.True(testIsClosed(ch1))
+	require.True(testIsClosed(ch2))
+	require.False(testIsClosed(ch3))
+	require.Equal(1, reg.Len(), "fired waiters are removed")
+
+	// A late watch on the old tree for a node a later tree replaced fires
+	// straight away, even a couple of commits later.
+	tree3 := testCommitTracked(tree2, func(txn *Txn[any]) { txn.Insert([]byte("wide/a"), 1) })
+	require.True(testIsClosed(ch3))
+	ch, _, _ := tree.GetWatch([]byte("wide/a"))
+	require.True(testIsClosed(ch))
+	ch, _, _ = tree2.GetWatch([]byte("wide/a"))
+	require.True(testIsClosed(ch))
+	ch, _, _ = tree3.GetWatch([]byte("wide/a"))
+	require.False(testIsClosed(ch))
+}
+
+func TestWatchAfterForkedCommits(t *testing.T) {
+	require := require.New(t)
+
+	// Two transactions from the same tree are committed. A late watcher of the
+	// original tree must see the changes from both of them.
+	tree := testBuildTree(testKeys(), 12)
+	testCommitTracked(tree, func(txn *Txn[any]) { txn.Insert([]byte("foo"), 1) })
+	testCommitTracked(tree, func(txn *Txn[any]) { txn.Insert([]byte("wide/a"), 1) })
+
+	ch, _, _ := tree.GetWatch([]byte("foo"))
+	require.True(testIsClosed(ch))
+	ch, _, _ = tree.GetWatch([]byte("wide/a"))
+	require.True(testIsClosed(ch))
+	ch = tree.WatchPrefix([]byte("wide/"))
+	require.True(testIsClosed(ch))
+
+	// Untouched keys still wait.
+	ch, _, _ = tree.GetWatch([]byte("wide/b"))
+	require.False(testIsClosed(ch))
+}
+
+func TestWatchForkOfReplacedNode(t *testing.T) {
+	require := require.New(t)
+
+	// Two trees are committed from the same tree and one of them replaces
+	// nodes the other still shares.
+	tree := testBuildTree(testKeys(), 13)
+	fork1 := testCommitTracked(tree, func(txn *Txn[any]) { txn.Insert([]byte("foo"), 1) })
+	fork2 := testCommitTracked(tree, func(txn *Txn[any]) { txn.Insert([]byte("wide/a"), 1) })
+	v, _ := fork2.Get([]byte("foo"))
+	require.Equal("foo", v)
+
+	// Nothing changed under foo in fork2 so its watchers wait, rather than
+	// waking straight away every time they watch again.
+	for i := 0; i < 3; i++ {
+		ch, _, _ := fork2.GetWatch([]byte("foo"))
+		require.False(testIsClosed(ch))
+		ch = fork2.WatchPrefix([]byte("foo/"))
+		require.False(testIsClosed(ch))
+	}
+	ch, _, _ := fork1.GetWatch([]byte("foo"))
+	require.False(testIsClosed(ch))
+
+	// The next commit from fork2 wakes them, whatever it changes.
+	ch, _, _ = fork2.GetWatch([]byte("foo"))
+	fork3 := testCommitTracked(fork2, func(txn *Txn[any]) { txn.Insert([]byte("wide/b"), 1) })
+	require.True(testIsClosed(ch))
+
+	// And the tree after that waits again.
+	ch, _, _ = fork3.GetWatch([]byte("foo"))
+	require.False(testIsClosed(ch))
+	testCommitTracked(fork3, func(txn *Txn[any]) { txn.Insert([]byte("foo"), 2) })
+	require.True(testIsClosed(ch))
+}
+
+func TestWatchPrefix(t *testing.T) {
+	cases := []struct {
+		name   string
+		prefix string
+		fn     func(txn *Txn[any])
+		fires  bool
+	}{
+		{"update under prefix", "foo/", func(txn *Txn[any]) { txn.Insert([]byte("foo/bar"), 1) }, true},
+		{"delete under prefix", "foo/", func(txn *Txn[any]) { txn.Delete([]byte("foo/baz")) }, true},
+		{"insert under prefix", "foo/", func(txn *Txn[any]) { txn.Insert([]byte("foo/new"), 1) }, true},
+		{"delete prefix", "wide/", func(txn *Txn[any]) { txn.DeletePrefix([]byte("wide/")) }, true},
+		{"update single leaf", "foo/bar/", func(txn *Txn[any]) { txn.Insert([]byte("foo/bar/baz"), 1) }, true},
+		{"insert beside single leaf", "foo/bar/", func(txn *Txn[any]) { txn.Insert([]byte("foo/bar/qux"), 1) }, true},
+		{"insert into empty prefix", "new/", func(txn *Txn[any]) { txn.Insert([]byte("new/key"), 1) }, true},
+		{"insert into empty prefix in node prefix", "mid/x", func(txn *Txn[any]) { txn.Insert([]byte("mid/xyz"), 1) }, true},
+		{"prefix ends in node prefix", testLongPrefix[0:15], func(txn *Txn[any]) { txn.Insert([]byte(testLongPrefix+"c"), 1) }, true},
+		{"change outside prefix", "foo/", func(txn *Txn[any]) { txn.Insert([]byte("wide/a"), 1) }, false},
+		{"change in sibling prefix", testLongPrefix + "bb", func(txn *Txn[any]) { txn.Insert([]byte(testLongPrefix+"a"), 1) }, false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tree := testBuildTree(testKeys(), 12)
+			ch := tree.WatchPrefix([]byte(tc.prefix))
+			require.False(t, testIsClosed(ch))
+			testCommitTracked(tree, tc.fn)
+			require.Equal(t, tc.fires, testIsClosed(ch))
+		})
+	}
+}
+
+func TestWatchPrefixEmptyAndLeafRoot(t *testing.T) {
+	require := require.New(t)
+
+	tree := New()
+	ch := tree.WatchPrefix([]byte("foo"))
+	tree = testCommitTracked(tree, func(txn *Txn[any]) { txn.Insert([]byte("foobar"), 1) })
+	require.True(testIsClosed(ch))
+
+	ch = tree.WatchPrefix([]byte("foo"))
+	tree = testCommitTracked(tree, func(txn *Txn[any]) { txn.Insert([]byte("foobaz"), 1) })
+	require.True(testIsClosed(ch))
+}